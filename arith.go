@@ -0,0 +1,202 @@
+package refine
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Errors reported by ArithmeticError. Each of them wraps ErrEval.
+var (
+	ErrDivideByZero = fmt.Errorf("%w: division by zero", ErrEval)
+	ErrShiftCount   = fmt.Errorf("%w: invalid shift count", ErrEval)
+	ErrOverflow     = fmt.Errorf("%w: integer overflow", ErrEval)
+	ErrNaN          = fmt.Errorf("%w: result is not a number", ErrEval)
+)
+
+// maxBigShift is the largest shift count allowed on a big.Int. It bounds the
+// memory a single refinement can allocate.
+const maxBigShift = 1 << 16
+
+// ArithmeticError is returned when an operation in a refinement cannot be
+// performed, such as dividing by zero. It unwraps to one of ErrDivideByZero,
+// ErrShiftCount, ErrOverflow or ErrNaN.
+type ArithmeticError struct {
+	Op    string // Operator, e.g. "/".
+	Left  any    // Left operand, or nil for unary operators.
+	Right any    // Right operand.
+	Err   error
+}
+
+// Error describes the problem like the other errors matching ErrEval, with
+// the operation after the text of ErrEval, e.g.
+// "could not be evaluated: 10 / 0: division by zero".
+func (e *ArithmeticError) Error() string {
+	problem := strings.TrimPrefix(e.Err.Error(), ErrEval.Error()+": ")
+	if e.Left == nil {
+		return fmt.Sprintf("%v: %s%v: %s", ErrEval, e.Op, e.Right, problem)
+	}
+	return fmt.Sprintf("%v: %v %s %v: %s", ErrEval, e.Left, e.Op, e.Right, problem)
+}
+
+func (e *ArithmeticError) Unwrap() error {
+	return e.Err
+}
+
+// binarySymbols maps binary operators to the text used to write them.
+var binarySymbols = map[binaryOperator]string{
+	binaryMultiply:           "*",
+	binaryDivide:             "/",
+	binaryModulo:             "%",
+	binaryMinus:              "-",
+	binaryPlus:               "+",
+	binaryLeftShift:          "<<",
+	binaryRightShift:         ">>",
+	binaryEqual:              "==",
+	binaryNotEqual:           "!=",
+	binaryLessThan:           "<",
+	binaryLessThanOrEqual:    "<=",
+	binaryGreaterThan:        ">",
+	binaryGreaterThanOrEqual: ">=",
+	binaryLogicalOr:          "||",
+	binaryLogicalAnd:         "&&",
+}
+
+func arithErr(op binaryOperator, left, right box, err error) error {
+	return &ArithmeticError{
+		Op:    binarySymbols[op],
+		Left:  left.val,
+		Right: right.val,
+		Err:   err,
+	}
+}
+
+// checkDivisor returns an error if right is a zero divisor for left.
+func checkDivisor(op binaryOperator, left, right box) error {
+	var zero bool
+	switch right.kind {
+	case boxInt:
+		zero = right.val.(int) == 0
+	case boxUint:
+		zero = right.val.(uint) == 0
+	case boxBigInt:
+		zero = right.val.(*big.Int).Sign() == 0
+	case boxBigFloat:
+		zero = right.val.(*big.Float).Sign() == 0
+	case boxBigRat:
+		zero = right.val.(*big.Rat).Sign() == 0
+	}
+	if zero {
+		return arithErr(op, left, right, ErrDivideByZero)
+	}
+	return nil
+}
+
+// checkShift returns an error if right is negative or too large to be used as
+// the count of a shift of left.
+func checkShift(op binaryOperator, left, right box) error {
+	var ok bool
+	switch right.kind {
+	case boxInt:
+		n := right.val.(int)
+		ok = n >= 0 && n < strconv.IntSize
+	case boxUint:
+		ok = right.val.(uint) < strconv.IntSize
+	case boxBigInt:
+		n := right.val.(*big.Int)
+		ok = n.Sign() >= 0 && n.Cmp(big.NewInt(maxBigShift)) <= 0
+	default:
+		return nil
+	}
+	if !ok {
+		return arithErr(op, left, right, ErrShiftCount)
+	}
+	return nil
+}
+
+// shiftCount converts a shift count checked by checkShift to the kind k, of
+// the value being shifted.
+func shiftCount(count box, k kind) box {
+	var n uint
+	if count.kind == boxInt {
+		n = uint(count.val.(int))
+	} else {
+		n = count.val.(uint)
+	}
+	if k == boxInt {
+		return box{kind: boxInt, val: int(n)}
+	}
+	return box{kind: boxUint, val: n}
+}
+
+// checkOverflow returns an error if applying op to two ints would overflow.
+func checkOverflow(op binaryOperator, left, right box) error {
+	if left.kind != boxInt || right.kind != boxInt {
+		return nil
+	}
+
+	x, y := left.val.(int), right.val.(int)
+	var overflow bool
+	switch op {
+	case binaryPlus:
+		overflow = (y > 0 && x > math.MaxInt-y) || (y < 0 && x < math.MinInt-y)
+	case binaryMinus:
+		overflow = (y < 0 && x > math.MaxInt+y) || (y > 0 && x < math.MinInt+y)
+	case binaryMultiply:
+		if x != 0 && y != 0 {
+			z := x * y
+			overflow = z/y != x || (x == -1 && y == math.MinInt) || (y == -1 && x == math.MinInt)
+		}
+	case binaryDivide:
+		overflow = x == math.MinInt && y == -1
+	case binaryLeftShift:
+		if y >= 0 && y < strconv.IntSize {
+			overflow = (x<<y)>>y != x
+		}
+	}
+	if overflow {
+		return arithErr(op, left, right, ErrOverflow)
+	}
+	return nil
+}
+
+// checkNegate returns an error if negating an int would overflow.
+func checkNegate(val box) error {
+	if val.kind == boxInt && val.val.(int) == math.MinInt {
+		return &ArithmeticError{Op: "-", Right: val.val, Err: ErrOverflow}
+	}
+	return nil
+}
+
+// resultOperand returns the operand whose type the result of applying op to
+// left and right has: the left for shifts, and otherwise whichever operand
+// isn't a constant.
+func resultOperand(op binaryOperator, left, right box) box {
+	if op == binaryLeftShift || op == binaryRightShift || left.typ != nil {
+		return left
+	}
+	return right
+}
+
+// truncate converts an int or uint to the integer type of the operand it was
+// computed from, if it is narrower than int or uint, as Go does for the result
+// of arithmetic on values of that type. It reports whether the value of a
+// signed integer changed, which is an overflow.
+func truncate(b, operand box) (box, bool) {
+	if operand.bits == 0 {
+		return b, false
+	}
+	shift := strconv.IntSize - operand.bits
+	switch b.kind {
+	case boxInt:
+		n := b.val.(int)
+		wrapped := n << shift >> shift
+		return box{kind: boxInt, val: wrapped, typ: operand.typ, bits: operand.bits}, wrapped != n
+	case boxUint:
+		n := b.val.(uint)
+		return box{kind: boxUint, val: n << shift >> shift, typ: operand.typ, bits: operand.bits}, false
+	}
+	return b, false
+}
@@ -0,0 +1,231 @@
+package refine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"unsafe"
+)
+
+// bigKinds maps the arbitrary-precision types of math/big to the kind of box
+// used to evaluate them. Fields may hold either the value or a pointer to it.
+var bigKinds = map[reflect.Type]kind{
+	reflect.TypeOf(big.Int{}):   boxBigInt,
+	reflect.TypeOf(big.Float{}): boxBigFloat,
+	reflect.TypeOf(big.Rat{}):   boxBigRat,
+}
+
+// isBig reports whether k is one of the arbitrary-precision kinds.
+func isBig(k kind) bool {
+	return k == boxBigInt || k == boxBigFloat || k == boxBigRat
+}
+
+// boxBig boxes a big.Int, big.Float or big.Rat, or a pointer to one. Values
+// are always boxed as pointers so the methods of math/big can be used on them.
+func boxBig(k kind, v reflect.Value) (box, error) {
+	if !v.CanInterface() {
+		// Values read from unexported fields can't be converted to an
+		// interface, so they are read through their address instead.
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if !v.CanAddr() {
+			return box{}, fmt.Errorf("%w %s read from an unexported field", ErrUnsupportedType, v.Type())
+		}
+		v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr()))
+	}
+	if v.Kind() != reflect.Pointer {
+		if v.CanAddr() {
+			v = v.Addr()
+		} else {
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			v = p
+		}
+	}
+	return box{kind: k, val: v.Interface()}, nil
+}
+
+// toBig converts a box holding an integer, float or big number to the big
+// kind k. It is used to implement the explicit promotion builtins.
+func toBig(k kind, b box) (box, error) {
+	switch b.kind {
+	case boxInt, boxUntypedIntConstant:
+		i := reflect.ValueOf(b.val).Int()
+		switch k {
+		case boxBigInt:
+			return box{kind: k, val: big.NewInt(i)}, nil
+		case boxBigFloat:
+			return box{kind: k, val: new(big.Float).SetInt64(i)}, nil
+		case boxBigRat:
+			return box{kind: k, val: new(big.Rat).SetInt64(i)}, nil
+		}
+	case boxUint:
+		u := reflect.ValueOf(b.val).Uint()
+		switch k {
+		case boxBigInt:
+			return box{kind: k, val: new(big.Int).SetUint64(u)}, nil
+		case boxBigFloat:
+			return box{kind: k, val: new(big.Float).SetUint64(u)}, nil
+		case boxBigRat:
+			return box{kind: k, val: new(big.Rat).SetInt(new(big.Int).SetUint64(u))}, nil
+		}
+	case boxFloat32, boxFloat64:
+		f := reflect.ValueOf(b.val).Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return box{}, fmt.Errorf("cannot convert %v to a big number", f)
+		}
+		switch k {
+		case boxBigInt:
+			i, _ := big.NewFloat(f).Int(nil)
+			return box{kind: k, val: i}, nil
+		case boxBigFloat:
+			return box{kind: k, val: big.NewFloat(f)}, nil
+		case boxBigRat:
+			return box{kind: k, val: new(big.Rat).SetFloat64(f)}, nil
+		}
+	case boxBigInt:
+		i := b.val.(*big.Int)
+		switch k {
+		case boxBigInt:
+			return b, nil
+		case boxBigFloat:
+			return box{kind: k, val: new(big.Float).SetInt(i)}, nil
+		case boxBigRat:
+			return box{kind: k, val: new(big.Rat).SetInt(i)}, nil
+		}
+	case boxBigFloat:
+		f := b.val.(*big.Float)
+		if f.IsInf() {
+			return box{}, fmt.Errorf("cannot convert %v to a finite number", f)
+		}
+		switch k {
+		case boxBigInt:
+			i, _ := f.Int(nil)
+			return box{kind: k, val: i}, nil
+		case boxBigFloat:
+			return b, nil
+		case boxBigRat:
+			r, _ := f.Rat(nil)
+			return box{kind: k, val: r}, nil
+		}
+	case boxBigRat:
+		r := b.val.(*big.Rat)
+		switch k {
+		case boxBigInt:
+			return box{kind: k, val: new(big.Int).Quo(r.Num(), r.Denom())}, nil
+		case boxBigFloat:
+			return box{kind: k, val: new(big.Float).SetRat(r)}, nil
+		case boxBigRat:
+			return b, nil
+		}
+	}
+	return box{}, fmt.Errorf("cannot convert kind %d to kind %d", b.kind, k)
+}
+
+// bigBuiltin returns a builtin that explicitly promotes its single argument to
+// the big kind k, e.g. bigInt(Count).
+func bigBuiltin(k kind) builtin {
+	return func(args []box) (box, error) {
+		if len(args) != 1 {
+			return box{}, fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+		return toBig(k, args[0])
+	}
+}
+
+// bigCmp compares two boxes of the same big kind, returning -1, 0 or +1.
+func bigCmp(left, right box) int {
+	switch left.kind {
+	case boxBigInt:
+		return left.val.(*big.Int).Cmp(right.val.(*big.Int))
+	case boxBigFloat:
+		return left.val.(*big.Float).Cmp(right.val.(*big.Float))
+	default:
+		return left.val.(*big.Rat).Cmp(right.val.(*big.Rat))
+	}
+}
+
+// bigArith applies an arithmetic operator to two boxes of the same big kind.
+// A new value is always allocated so the operands are never modified.
+func bigArith(op binaryOperator, left, right box) (result box, err error) {
+	// Operations on big.Float that have no defined result, such as adding
+	// infinities of opposite sign, panic with big.ErrNaN.
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			result, err = box{}, arithErr(op, left, right, ErrNaN)
+		}
+	}()
+
+	var v any
+	switch left.kind {
+	case boxBigInt:
+		x, y := left.val.(*big.Int), right.val.(*big.Int)
+		switch op {
+		case binaryPlus:
+			v = new(big.Int).Add(x, y)
+		case binaryMinus:
+			v = new(big.Int).Sub(x, y)
+		case binaryMultiply:
+			v = new(big.Int).Mul(x, y)
+		case binaryDivide:
+			v = new(big.Int).Quo(x, y)
+		case binaryModulo:
+			v = new(big.Int).Rem(x, y)
+		case binaryLeftShift, binaryRightShift:
+			if !y.IsUint64() {
+				return box{}, arithErr(op, left, right, ErrShiftCount)
+			}
+			if op == binaryLeftShift {
+				v = new(big.Int).Lsh(x, uint(y.Uint64()))
+			} else {
+				v = new(big.Int).Rsh(x, uint(y.Uint64()))
+			}
+		}
+	case boxBigFloat:
+		x, y := left.val.(*big.Float), right.val.(*big.Float)
+		switch op {
+		case binaryPlus:
+			v = new(big.Float).Add(x, y)
+		case binaryMinus:
+			v = new(big.Float).Sub(x, y)
+		case binaryMultiply:
+			v = new(big.Float).Mul(x, y)
+		case binaryDivide:
+			v = new(big.Float).Quo(x, y)
+		}
+	case boxBigRat:
+		x, y := left.val.(*big.Rat), right.val.(*big.Rat)
+		switch op {
+		case binaryPlus:
+			v = new(big.Rat).Add(x, y)
+		case binaryMinus:
+			v = new(big.Rat).Sub(x, y)
+		case binaryMultiply:
+			v = new(big.Rat).Mul(x, y)
+		case binaryDivide:
+			v = new(big.Rat).Quo(x, y)
+		}
+	}
+	if v == nil {
+		return box{}, errors.New("invalid type!")
+	}
+	return box{kind: left.kind, val: v}, nil
+}
+
+// bigNeg negates a box of a big kind.
+func bigNeg(b box) box {
+	switch b.kind {
+	case boxBigInt:
+		return box{kind: b.kind, val: new(big.Int).Neg(b.val.(*big.Int))}
+	case boxBigFloat:
+		return box{kind: b.kind, val: new(big.Float).Neg(b.val.(*big.Float))}
+	default:
+		return box{kind: b.kind, val: new(big.Rat).Neg(b.val.(*big.Rat))}
+	}
+}
@@ -10,23 +10,24 @@ func _() {
 	var x [1]struct{}
 	_ = x[binaryMultiply-0]
 	_ = x[binaryDivide-1]
-	_ = x[binaryMinus-2]
-	_ = x[binaryPlus-3]
-	_ = x[binaryLeftShift-4]
-	_ = x[binaryRightShift-5]
-	_ = x[binaryEqual-6]
-	_ = x[binaryNotEqual-7]
-	_ = x[binaryLessThan-8]
-	_ = x[binaryLessThanOrEqual-9]
-	_ = x[binaryGreaterThan-10]
-	_ = x[binaryGreaterThanOrEqual-11]
-	_ = x[binaryLogicalOr-12]
-	_ = x[binaryLogicalAnd-13]
+	_ = x[binaryModulo-2]
+	_ = x[binaryMinus-3]
+	_ = x[binaryPlus-4]
+	_ = x[binaryLeftShift-5]
+	_ = x[binaryRightShift-6]
+	_ = x[binaryEqual-7]
+	_ = x[binaryNotEqual-8]
+	_ = x[binaryLessThan-9]
+	_ = x[binaryLessThanOrEqual-10]
+	_ = x[binaryGreaterThan-11]
+	_ = x[binaryGreaterThanOrEqual-12]
+	_ = x[binaryLogicalOr-13]
+	_ = x[binaryLogicalAnd-14]
 }
 
-const _binaryOperator_name = "binaryMultiplybinaryDividebinaryMinusbinaryPlusbinaryLeftShiftbinaryRightShiftbinaryEqualbinaryNotEqualbinaryLessThanbinaryLessThanOrEqualbinaryGreaterThanbinaryGreaterThanOrEqualbinaryLogicalOrbinaryLogicalAnd"
+const _binaryOperator_name = "binaryMultiplybinaryDividebinaryModulobinaryMinusbinaryPlusbinaryLeftShiftbinaryRightShiftbinaryEqualbinaryNotEqualbinaryLessThanbinaryLessThanOrEqualbinaryGreaterThanbinaryGreaterThanOrEqualbinaryLogicalOrbinaryLogicalAnd"
 
-var _binaryOperator_index = [...]uint8{0, 14, 26, 37, 47, 62, 78, 89, 103, 117, 138, 155, 179, 194, 210}
+var _binaryOperator_index = [...]uint8{0, 14, 26, 38, 49, 59, 74, 90, 101, 115, 129, 150, 167, 191, 206, 222}
 
 func (i binaryOperator) String() string {
 	if i < 0 || i >= binaryOperator(len(_binaryOperator_index)-1) {
@@ -0,0 +1,235 @@
+package refine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// callError wraps an error returned by a Go function or method called from a
+// refinement. It matches ErrEval while preserving the original error, and
+// like the other errors matching ErrEval its text starts with that of ErrEval.
+type callError struct {
+	name string
+	err  error
+}
+
+func (e *callError) Error() string {
+	return fmt.Sprintf("%v: %s returned an error: %v", ErrEval, e.name, e.err)
+}
+
+func (e *callError) Unwrap() error {
+	return e.err
+}
+
+func (e *callError) Is(target error) bool {
+	return target == ErrEval
+}
+
+// method describes a method that can be called from a refinement.
+type method struct {
+	index int   // Index of the method in the method set of the receiver.
+	ptr   bool  // Whether the method needs a pointer receiver.
+	err   error // Why the method can't be called, if it can't.
+}
+
+type methodKey struct {
+	typ  reflect.Type
+	name string
+}
+
+// methods caches method lookups by receiver type and name.
+var methods sync.Map // map[methodKey]*method
+
+// lookupMethod finds the method called name on values of type t, or on
+// pointers to them, and checks that it can be called from a refinement.
+func lookupMethod(t reflect.Type, name string) *method {
+	key := methodKey{typ: t, name: name}
+	if m, ok := methods.Load(key); ok {
+		return m.(*method)
+	}
+
+	m := &method{}
+	sel, ok := t.MethodByName(name)
+	if !ok && t.Kind() != reflect.Pointer {
+		sel, ok = reflect.PointerTo(t).MethodByName(name)
+		m.ptr = ok
+	}
+	if ok {
+		m.index = sel.Index
+		// The first parameter of the method's function is its receiver.
+		m.err = checkSignature(sel.Func.Type(), 1)
+	} else {
+		m.err = fmt.Errorf("%s has no method %s", t, name)
+	}
+
+	actual, _ := methods.LoadOrStore(key, m)
+	return actual.(*method)
+}
+
+// checkSignature checks that a function can be called from a refinement. Its
+// parameters, after skipping the first skip of them, must be basic types so
+// that the function cannot modify the values it is given. It must return one
+// value, optionally followed by an error.
+func checkSignature(fn reflect.Type, skip int) error {
+	for i := skip; i < fn.NumIn(); i++ {
+		in := fn.In(i)
+		if fn.IsVariadic() && i == fn.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isBasic(in) {
+			return fmt.Errorf("parameter of type %s is not allowed", in)
+		}
+	}
+
+	switch fn.NumOut() {
+	case 1:
+	case 2:
+		if fn.Out(1) != errorType {
+			return fmt.Errorf("second result must be an error, not %s", fn.Out(1))
+		}
+	default:
+		return fmt.Errorf("must return 1 or 2 values, not %d", fn.NumOut())
+	}
+	return nil
+}
+
+// isBasic reports whether t is a boolean, numeric or string type.
+func isBasic(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// reflectValue returns the Go value held by a box as its original type.
+func reflectValue(b box) (reflect.Value, error) {
+	if b.kind == boxUntypedNilConstant {
+		return reflect.Value{}, errors.New("value is nil")
+	}
+	if b.val == nil {
+		if b.typ == nil {
+			return reflect.Value{}, errors.New("value is nil")
+		}
+		return reflect.Zero(b.typ), nil
+	}
+	if v, ok := b.val.(reflect.Value); ok {
+		return v, nil
+	}
+	return reflect.ValueOf(b.original()), nil
+}
+
+// convertArg converts a box to a value of type t, to be passed to a Go function.
+func convertArg(b box, t reflect.Type) (reflect.Value, error) {
+	if b.dynamic {
+		return reflect.Value{}, errNotNarrowed
+	}
+
+	var v reflect.Value
+	switch b.kind {
+	case boxUntypedIntConstant, boxBool, boxInt, boxUint, boxFloat32, boxFloat64, boxString:
+		v = reflect.ValueOf(b.val)
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot use kind %d as %s", b.kind, t)
+	}
+
+	// Values may be converted between named types with the same underlying
+	// kind, and integer constants to any numeric type they fit in.
+	switch {
+	case v.Kind() == t.Kind():
+	case b.kind == boxUntypedIntConstant && isNumeric(t):
+		i := v.Int()
+		switch {
+		case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+			if reflect.Zero(t).OverflowInt(i) {
+				return reflect.Value{}, fmt.Errorf("constant %d overflows %s", i, t)
+			}
+		case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+			if i < 0 || reflect.Zero(t).OverflowUint(uint64(i)) {
+				return reflect.Value{}, fmt.Errorf("constant %d overflows %s", i, t)
+			}
+		}
+	case b.kind == boxInt && t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64,
+		b.kind == boxUint && t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		// Narrower integer types from fields convert back losslessly.
+		if b.typ == nil || b.typ.Kind() != t.Kind() {
+			return reflect.Value{}, fmt.Errorf("cannot use %v as %s", b.val, t)
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot use kind %d as %s", b.kind, t)
+	}
+	return v.Convert(t), nil
+}
+
+// isNumeric reports whether t is an integer or floating point type.
+func isNumeric(t reflect.Type) bool {
+	return isBasic(t) && t.Kind() != reflect.Bool && t.Kind() != reflect.String
+}
+
+// call calls a Go function with the boxes given as arguments and boxes its
+// result. A non-nil error result is returned as a callError, as is a panic.
+func call(name string, fn reflect.Value, args []box) (result box, err error) {
+	t := fn.Type()
+	n := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < n-1 {
+			return box{}, fmt.Errorf("%s expects at least %d arguments, got %d", name, n-1, len(args))
+		}
+	} else if len(args) != n {
+		return box{}, fmt.Errorf("%s expects %d arguments, got %d", name, n, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		v, err := convertArg(arg, paramType(t, i))
+		if err != nil {
+			return box{}, fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+		}
+		in[i] = v
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = box{}, &callError{name: name, err: fmt.Errorf("panic: %v", r)}
+		}
+	}()
+
+	out := fn.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return box{}, &callError{name: name, err: out[1].Interface().(error)}
+	}
+	return boxValue(out[0])
+}
+
+// callMethod calls the method called name on the value held by recv.
+func callMethod(recv box, name string, args []box) (box, error) {
+	v, err := reflectValue(recv)
+	if err != nil {
+		return box{}, fmt.Errorf("cannot call %s: %w", name, err)
+	}
+
+	if !v.CanInterface() {
+		return box{}, fmt.Errorf("cannot call %s on a value read from an unexported field", name)
+	}
+
+	m := lookupMethod(v.Type(), name)
+	if m.err != nil {
+		return box{}, fmt.Errorf("cannot call %s: %w", name, m.err)
+	}
+
+	// Methods with pointer receivers are called on a copy of a value that
+	// isn't a pointer, as it may not be addressable. The methods of pointers
+	// are called on the values they point to, which they can modify.
+	if m.ptr {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+
+	return call(name, v.Method(m.index), args)
+}
@@ -0,0 +1,39 @@
+package refine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupMethod(t *testing.T) {
+	testCases := []struct {
+		name   string
+		typ    reflect.Type
+		method string
+
+		wantPtr bool
+		wantErr bool
+	}{
+		{"ValueReceiver", reflect.TypeOf(testVersion("")), "Major", false, false},
+		{"PointerReceiver", reflect.TypeOf(testID{}), "IsZero", true, false},
+		{"PointerType", reflect.TypeOf(&testID{}), "IsZero", false, false},
+		{"Missing", reflect.TypeOf(testVersion("")), "Minor", false, true},
+		{"SliceParameter", reflect.TypeOf(testVersion("")), "Split", false, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			m := lookupMethod(tc.typ, tc.method)
+			if m.ptr != tc.wantPtr {
+				t.Fatalf("got ptr %v, want %v", m.ptr, tc.wantPtr)
+			}
+			if (m.err != nil) != tc.wantErr {
+				t.Fatalf("got err %v, want err %v", m.err, tc.wantErr)
+			}
+			if lookupMethod(tc.typ, tc.method) != m {
+				t.Fatalf("lookup of %s.%s was not cached", tc.typ, tc.method)
+			}
+		})
+	}
+}
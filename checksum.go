@@ -0,0 +1,234 @@
+package refine
+
+import "strings"
+
+// checksums are the builtin functions that validate identifiers protected by
+// a check digit. When one is not valid they report the rule it breaks.
+var checksums = map[string]any{
+	"luhn":  luhn,
+	"iban":  iban,
+	"isbn":  isbn,
+	"ean13": ean13,
+	"vin":   vin,
+}
+
+// ruleError reports the rule of a format that a value breaks. Functions that
+// return one make their call false rather than failing to evaluate, and the
+// rule is included in the error reported if the refinement is not met.
+type ruleError struct {
+	name string
+	rule string
+}
+
+func (e *ruleError) Error() string {
+	return e.name + ": " + e.rule
+}
+
+func broken(name, rule string) (bool, error) {
+	return false, &ruleError{name: name, rule: rule}
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn reports whether s is a number, such as a payment card number, whose
+// last digit is correct according to the Luhn algorithm. Spaces between
+// groups of digits are ignored.
+func luhn(s string) (bool, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	switch {
+	case !isDigits(s):
+		return broken("luhn", "must contain only digits")
+	case len(s) < 2:
+		return broken("luhn", "must have at least 2 digits")
+	}
+
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[len(s)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return broken("luhn", "check digit is wrong")
+	}
+	return true, nil
+}
+
+// ibanLengths is the length of IBANs in each country that uses them.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16,
+	"BG": 22, "BH": 22, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28,
+	"CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24,
+	"FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18,
+	"GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23,
+	"IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32,
+	"LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22,
+	"MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24,
+	"PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// iban reports whether s is an International Bank Account Number with the
+// length used by its country and correct check digits, as described by ISO
+// 13616. Spaces between groups of characters are ignored.
+func iban(s string) (bool, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(s) < 4 {
+		return broken("iban", "must have a country code and check digits")
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9') && !('A' <= c && c <= 'Z') {
+			return broken("iban", "must contain only letters and digits")
+		}
+	}
+	n, ok := ibanLengths[s[:2]]
+	switch {
+	case !ok:
+		return broken("iban", "country code "+s[:2]+" is unknown")
+	case !isDigits(s[2:4]):
+		return broken("iban", "check digits must be digits")
+	case len(s) != n:
+		return broken("iban", "length is wrong for country "+s[:2])
+	}
+
+	// Moving the first four characters to the end and replacing letters by
+	// numbers from 10 to 35 gives a number which is 1 modulo 97.
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		if c >= 'A' {
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		} else {
+			rem = (rem*10 + int(c-'0')) % 97
+		}
+	}
+	if rem != 1 {
+		return broken("iban", "check digits are wrong")
+	}
+	return true, nil
+}
+
+// isbn reports whether s is a 10 or 13 digit International Standard Book
+// Number with a correct check digit. Hyphens and spaces are ignored.
+func isbn(s string) (bool, error) {
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	switch len(s) {
+	case 10:
+		if !isDigits(s[:9]) || !isDigits(s[9:]) && s[9] != 'X' {
+			return broken("isbn", "must contain only digits, and X as the check digit")
+		}
+		sum := 0
+		for i := 0; i < 10; i++ {
+			d := 10
+			if s[i] != 'X' {
+				d = int(s[i] - '0')
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return broken("isbn", "check digit is wrong")
+		}
+		return true, nil
+	case 13:
+		if !isDigits(s) {
+			return broken("isbn", "must contain only digits")
+		}
+		if !strings.HasPrefix(s, "978") && !strings.HasPrefix(s, "979") {
+			return broken("isbn", "must start with 978 or 979")
+		}
+		if !eanCheck(s) {
+			return broken("isbn", "check digit is wrong")
+		}
+		return true, nil
+	}
+	return broken("isbn", "must have 10 or 13 digits")
+}
+
+// ean13 reports whether s is a 13 digit International Article Number, as
+// used in barcodes, with a correct check digit.
+func ean13(s string) (bool, error) {
+	switch {
+	case !isDigits(s):
+		return broken("ean13", "must contain only digits")
+	case len(s) != 13:
+		return broken("ean13", "must have 13 digits")
+	case !eanCheck(s):
+		return broken("ean13", "check digit is wrong")
+	}
+	return true, nil
+}
+
+// eanCheck reports whether the last of a string of digits is the EAN check
+// digit of the others.
+func eanCheck(s string) bool {
+	sum := 0
+	for i := 0; i < len(s)-1; i++ {
+		d := int(s[len(s)-2-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(s[len(s)-1]-'0')
+}
+
+// vinWeights are the weights of the characters of a VIN in its check digit.
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinValue returns the value of a character of a VIN, or -1 if it can't be
+// used in one. The letters I, O and Q are not used.
+func vinValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'A' <= c && c <= 'H':
+		return int(c-'A') + 1
+	case 'J' <= c && c <= 'N':
+		return int(c-'J') + 1
+	case c == 'P':
+		return 7
+	case c == 'R':
+		return 9
+	case 'S' <= c && c <= 'Z':
+		return int(c-'S') + 2
+	}
+	return -1
+}
+
+// vin reports whether s is a 17 character Vehicle Identification Number with
+// a correct check digit in its ninth position, as required in North America.
+func vin(s string) (bool, error) {
+	if len(s) != 17 {
+		return broken("vin", "must have 17 characters")
+	}
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		v := vinValue(s[i])
+		if v < 0 {
+			return broken("vin", "must contain only digits and capital letters other than I, O and Q")
+		}
+		sum += v * vinWeights[i]
+	}
+
+	check := byte('0' + sum%11)
+	if sum%11 == 10 {
+		check = 'X'
+	}
+	if s[8] != check {
+		return broken("vin", "check digit is wrong")
+	}
+	return true, nil
+}
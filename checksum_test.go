@@ -0,0 +1,141 @@
+package refine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	testCases := []struct {
+		fn    string
+		input string
+
+		want     bool
+		wantRule string
+	}{
+		{"luhn", "4111111111111111", true, ""},
+		{"luhn", "4111 1111 1111 1111", true, ""},
+		{"luhn", "79927398713", true, ""},
+		{"luhn", "79927398710", false, "check digit is wrong"},
+		{"luhn", "4111-1111", false, "must contain only digits"},
+		{"luhn", "0", false, "must have at least 2 digits"},
+		{"iban", "GB82 WEST 1234 5698 7654 32", true, ""},
+		{"iban", "DE89370400440532013000", true, ""},
+		{"iban", "gb82west12345698765432", true, ""},
+		{"iban", "GB82WEST12345698765433", false, "check digits are wrong"},
+		{"iban", "GB82WEST123456987654", false, "length is wrong for country GB"},
+		{"iban", "ZZ82WEST12345698765432", false, "country code ZZ is unknown"},
+		{"iban", "GBXXWEST12345698765432", false, "check digits must be digits"},
+		{"iban", "GB82-WEST", false, "must contain only letters and digits"},
+		{"iban", "GB", false, "must have a country code and check digits"},
+		{"isbn", "0-306-40615-2", true, ""},
+		{"isbn", "0 8044 2957 X", true, ""},
+		{"isbn", "978-0-306-40615-7", true, ""},
+		{"isbn", "0-306-40615-3", false, "check digit is wrong"},
+		{"isbn", "978-0-306-40615-6", false, "check digit is wrong"},
+		{"isbn", "977-0-306-40615-7", false, "must start with 978 or 979"},
+		{"isbn", "X-306-40615-2", false, "must contain only digits, and X as the check digit"},
+		{"isbn", "0-306-40615", false, "must have 10 or 13 digits"},
+		{"ean13", "4006381333931", true, ""},
+		{"ean13", "4006381333932", false, "check digit is wrong"},
+		{"ean13", "400638133393", false, "must have 13 digits"},
+		{"ean13", "400638133393A", false, "must contain only digits"},
+		{"vin", "1M8GDM9AXKP042788", true, ""},
+		{"vin", "11111111111111111", true, ""},
+		{"vin", "1M8GDM9A1KP042788", false, "check digit is wrong"},
+		{"vin", "1M8GDM9AXKP04278O", false, "must contain only digits and capital letters other than I, O and Q"},
+		{"vin", "1M8GDM9AXKP04278", false, "must have 17 characters"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.fn+"/"+tc.input, func(t *testing.T) {
+			got, err := checksums[tc.fn].(func(string) (bool, error))(tc.input)
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+
+			var rule string
+			var re *ruleError
+			if errors.As(err, &re) {
+				rule = re.rule
+			} else if err != nil {
+				t.Fatalf("got err %v, want a rule", err)
+			}
+			if rule != tc.wantRule {
+				t.Fatalf("got rule %q, want %q", rule, tc.wantRule)
+			}
+		})
+	}
+}
+
+func TestCheckChecksums(t *testing.T) {
+	type payment struct {
+		Card    string `refine:"luhn(Card)"`
+		Account string "refine:\"Account == `` || iban(Account)\""
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want     error
+		wantText string
+	}{
+		{"Met", payment{Card: "4111111111111111", Account: "GB82WEST12345698765432"}, nil, ""},
+		{"CardNotMet", payment{Card: "4111111111111112"}, ErrNotMet, "luhn: check digit is wrong"},
+		{"AccountNotMet", payment{Card: "4111111111111111", Account: "GB00"}, ErrNotMet, "iban: length is wrong for country GB"},
+		{"Negated", struct {
+			Card string `refine:"!luhn(Card)"`
+		}{Card: "4111111111111112"}, nil, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+func TestCheckChecksumNotes(t *testing.T) {
+	const invalid, valid = "4111111111111112", "4111111111111111"
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want string
+	}{
+		{"NotDeciding", struct {
+			Card string `refine:"!luhn(Card) && len(Card) < 10"`
+		}{Card: invalid}, `refine.Check: .Card = "4111111111111112", "!luhn(Card) && len(Card) < 10" not met`},
+		{"Deciding", struct {
+			Card string `refine:"luhn(Card) && len(Card) > 10"`
+		}{Card: invalid}, `refine.Check: .Card = "4111111111111112", "luhn(Card) && len(Card) > 10" not met: luhn: check digit is wrong`},
+		{"AnyMet", struct {
+			Card  string `refine:"any([Card, Spare], c, luhn(c)) && len(Card) < 10"`
+			Spare string
+		}{Card: invalid, Spare: valid}, `refine.Check: .Card = "4111111111111112", "any([Card, Spare], c, luhn(c)) && len(Card) < 10" not met`},
+		{"AllNotMet", struct {
+			Card string `refine:"all([Card], c, luhn(c)) || len(Card) < 10"`
+		}{Card: invalid}, `refine.Check: .Card = "4111111111111112", "all([Card], c, luhn(c)) || len(Card) < 10" not met: luhn: check digit is wrong`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(tc.value)
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("got %v; want %s", err, tc.want)
+			}
+		})
+	}
+}
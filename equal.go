@@ -0,0 +1,237 @@
+package refine
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// visit records a pair of values being compared so cycles can be detected.
+type visit struct {
+	left  uintptr
+	right uintptr
+	typ   reflect.Type
+}
+
+// equalBoxes reports whether two boxes are equal. Values of types that are
+// comparable in Go are equal exactly when == would report them equal. Slices,
+// maps and structs containing them are compared element by element, with nil
+// and empty slices or maps being equal. If deep is true pointers are followed
+// rather than compared by address and values of different types are unequal,
+// as in reflect.DeepEqual.
+func equalBoxes(left, right box, deep bool) (bool, error) {
+	if left.kind == boxList || right.kind == boxList {
+		return equalLists(left, right, deep)
+	}
+
+	if left.kind == boxUntypedNilConstant || right.kind == boxUntypedNilConstant {
+		return isNil(left.val) && isNil(right.val), nil
+	}
+
+	// Basic values are boxed as their underlying types, so the types they
+	// were read from are compared too.
+	if left.typ != nil && right.typ != nil && left.typ != right.typ {
+		if deep {
+			return false, nil
+		}
+		return false, errMismatch(left, right)
+	}
+
+	l, r := left.value(), right.value()
+	if !l.IsValid() || !r.IsValid() {
+		// Nil pointers are boxed without their type.
+		return !l.IsValid() && !r.IsValid(), nil
+	}
+	if l.Type() != r.Type() {
+		if deep {
+			return false, nil
+		}
+		return false, fmt.Errorf("type mismatch: %s != %s", l.Type(), r.Type())
+	}
+
+	return equalValues(l, r, deep, map[visit]bool{}), nil
+}
+
+// elements returns the elements of a list literal, slice or array as boxes.
+func elements(b box) ([]box, error) {
+	if b.kind == boxList {
+		return b.val.([]box), nil
+	}
+
+	v := b.value()
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("kind %d has no elements", b.kind)
+	}
+
+	elems := make([]box, v.Len())
+	for i := range elems {
+		elem, err := boxValue(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = elem
+	}
+	return elems, nil
+}
+
+// equalLists compares a list literal with another list, slice or array one
+// element at a time. Untyped constants in the list take on the kind of the
+// element they are compared with.
+func equalLists(left, right box, deep bool) (bool, error) {
+	l, err := elements(left)
+	if err != nil {
+		return false, err
+	}
+	r, err := elements(right)
+	if err != nil {
+		return false, err
+	}
+	if len(l) != len(r) {
+		return false, nil
+	}
+
+	for i := range l {
+		x, y, err := coerceUntypedInt(l[i], r[i])
+		if err != nil {
+			return false, err
+		}
+		if x.kind != y.kind && x.kind != boxList && y.kind != boxList &&
+			x.kind != boxUntypedNilConstant && y.kind != boxUntypedNilConstant {
+			if deep {
+				return false, nil
+			}
+			return false, fmt.Errorf("type mismatch at index %d: %d != %d", i, x.kind, y.kind)
+		}
+		eq, err := equalBoxes(x, y, deep)
+		if err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// equalValues compares two values of the same type. See equalBoxes.
+func equalValues(l, r reflect.Value, deep bool, visited map[visit]bool) bool {
+	switch l.Kind() {
+	case reflect.Bool:
+		return l.Bool() == r.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return l.Int() == r.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return l.Uint() == r.Uint()
+	case reflect.Float32, reflect.Float64:
+		return l.Float() == r.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return l.Complex() == r.Complex()
+	case reflect.String:
+		return l.String() == r.String()
+	case reflect.Chan, reflect.UnsafePointer:
+		return l.Pointer() == r.Pointer()
+	case reflect.Func:
+		// Functions are only comparable to nil.
+		return l.IsNil() && r.IsNil()
+	case reflect.Pointer:
+		if l.Pointer() == r.Pointer() {
+			return true
+		}
+		if !deep || l.IsNil() || r.IsNil() {
+			return false
+		}
+		if seen(l, r, visited) {
+			return true
+		}
+		return equalValues(l.Elem(), r.Elem(), deep, visited)
+	case reflect.Interface:
+		if l.IsNil() || r.IsNil() {
+			return l.IsNil() && r.IsNil()
+		}
+		l, r = l.Elem(), r.Elem()
+		if l.Type() != r.Type() {
+			return false
+		}
+		return equalValues(l, r, deep, visited)
+	case reflect.Array:
+		for i := 0; i < l.Len(); i++ {
+			if !equalValues(l.Index(i), r.Index(i), deep, visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < l.NumField(); i++ {
+			// Blank fields are ignored by ==.
+			if l.Type().Field(i).Name == "_" {
+				continue
+			}
+			if !equalValues(l.Field(i), r.Field(i), deep, visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if l.Len() != r.Len() {
+			return false
+		}
+		if l.Len() == 0 || l.Pointer() == r.Pointer() {
+			return true
+		}
+		if seen(l, r, visited) {
+			return true
+		}
+		for i := 0; i < l.Len(); i++ {
+			if !equalValues(l.Index(i), r.Index(i), deep, visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if l.Len() != r.Len() {
+			return false
+		}
+		if l.Len() == 0 || l.Pointer() == r.Pointer() {
+			return true
+		}
+		if seen(l, r, visited) {
+			return true
+		}
+		iter := l.MapRange()
+		for iter.Next() {
+			v := r.MapIndex(iter.Key())
+			if !v.IsValid() || !equalValues(iter.Value(), v, deep, visited) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// seen records that l and r are being compared, and reports whether they
+// already were. Comparisons that revisit a pair are assumed to be equal, which
+// is what allows cyclic values to be compared.
+func seen(l, r reflect.Value, visited map[visit]bool) bool {
+	v := visit{left: l.Pointer(), right: r.Pointer(), typ: l.Type()}
+	if visited[v] {
+		return true
+	}
+	visited[v] = true
+	return false
+}
+
+// builtinDeepEqual implements deepEqual(a, b), which is like == but follows
+// pointers and reports values of different types as unequal.
+func builtinDeepEqual(args []box) (box, error) {
+	if len(args) != 2 {
+		return box{}, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	left, right, err := coerceUntypedInt(args[0], args[1])
+	if err != nil {
+		return box{}, err
+	}
+
+	eq, err := equalBoxes(left, right, true)
+	if err != nil {
+		return box{}, err
+	}
+	return box{kind: boxBool, val: eq}, nil
+}
@@ -0,0 +1,74 @@
+package refine
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEqualBoxes(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+		Refs  []any
+	}
+
+	type blank struct {
+		A int
+		_ int
+	}
+
+	cycle := func(v int) *node {
+		n := &node{Value: v}
+		n.Next = n
+		n.Refs = []any{n.Refs}
+		n.Refs[0] = n.Refs
+		return n
+	}
+
+	testCases := []struct {
+		name  string
+		left  any
+		right any
+		deep  bool
+
+		want bool
+	}{
+		{"Ints", 1, 1, false, true},
+		{"NaN", []float64{math.NaN()}, []float64{math.NaN()}, false, false},
+		{"Slices", []int{1, 2}, []int{1, 2}, false, true},
+		{"SlicesLength", []int{1, 2}, []int{1}, false, false},
+		{"NilAndEmpty", []int(nil), []int{}, false, true},
+		{"Maps", map[int]string{1: "a"}, map[int]string{1: "a"}, false, true},
+		{"MapsMissingKey", map[int]string{1: "a"}, map[int]string{2: "a"}, false, false},
+		{"Interfaces", []any{1, "a"}, []any{1, "a"}, false, true},
+		{"InterfaceTypes", []any{1}, []any{int64(1)}, false, false},
+		{"BlankFields", blank{A: 1}, blank{A: 1}, false, true},
+		{"PointersByAddress", &node{Value: 1}, &node{Value: 1}, false, false},
+		{"PointersDeep", &node{Value: 1}, &node{Value: 1}, true, true},
+		{"CyclesDeep", cycle(1), cycle(1), true, true},
+		{"CyclesDeepNotEqual", cycle(1), cycle(2), true, false},
+		{"TypesDeep", 1, "a", true, false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			left, err := boxValue(reflect.ValueOf(tc.left))
+			if err != nil {
+				t.Fatal(err)
+			}
+			right, err := boxValue(reflect.ValueOf(tc.right))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := equalBoxes(left, right, tc.deep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package refine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors is returned by CheckAll when refinements are not met, with an error
+// for each of them. errors.Is and errors.As look for targets in each error in
+// turn.
+type Errors []error
+
+// Error returns the text of each error on its own line.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Is reports whether any of the errors matches target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target, and if one does sets
+// target to it and returns true.
+func (e Errors) As(target any) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorKind is the way in which checking a refinement failed.
+type ErrorKind int
+
+const (
+	KindParse  ErrorKind = iota // The refinement, or the options of its tag, could not be parsed.
+	KindEval                    // The refinement could not be evaluated.
+	KindNotMet                  // The refinement was false.
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindParse:
+		return "parse"
+	case KindEval:
+		return "eval"
+	case KindNotMet:
+		return "not met"
+	}
+	return "ErrorKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// FieldError is the error returned for a refinement on a field, or on a struct
+// as a whole, that could not be checked or was not met. It wraps ErrParse,
+// ErrEval or ErrNotMet depending on its Kind.
+type FieldError struct {
+	Struct     string // Name of the type of the struct with the refinement.
+	Field      string // Name of the field, or "" for refinements on the struct.
+	Path       string // Path from the struct given to Check, e.g. Order.Lines[0].Price.
+	Value      any    // Value of the field, or nil for refinements on the struct.
+	Refinement string // The clause that failed, or the whole tag if its options are wrong.
+	Kind       ErrorKind
+	Clause     int // Position of the clause among those of the refinement.
+	Offset     int // Byte offset of the clause's expression in the refinement.
+
+	resolved string // What references in the refinement resolved to.
+	message  string // From the refinemsg tag, interpolated.
+	code     string // From the refinecode tag.
+	err      error
+
+	explanation string // Rendered when the Explain option is used.
+}
+
+func (e *FieldError) Error() string {
+	var msg string
+	if e.Field == "" {
+		// Refinements on the struct itself.
+		msg = fmt.Sprintf("refine.Check: %s %q %v", e.Path, e.Refinement, e.err)
+	} else {
+		msg = fmt.Sprintf("refine.Check: %s = %#+v, %q %v", e.Path, e.Value, e.Refinement, e.err)
+	}
+	if e.resolved != "" {
+		msg += " (" + e.resolved + ")"
+	}
+	if e.explanation != "" {
+		msg += "\n" + e.explanation
+	}
+	return msg
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// Explanation returns the explanation of why the refinement failed, which is
+// also included in the text of the error, or "" unless the Explain option was
+// used.
+func (e *FieldError) Explanation() string {
+	return e.explanation
+}
+
+// Code returns the code given by the refinecode tag of the field whose
+// refinement was not met, or "" if it has none.
+func (e *FieldError) Code() string {
+	return e.code
+}
+
+// Message returns the message given by the refinemsg tag of the field whose
+// refinement was not met, or the text of the error if it has none.
+func (e *FieldError) Message() string {
+	if e.message == "" {
+		return e.Error()
+	}
+	return e.message
+}
+
+// ParseError is the error for the clause of a refinement that can't be parsed,
+// or that calls a function which doesn't exist or with the wrong arguments. It
+// wraps ErrParse, and is itself wrapped by a FieldError.
+type ParseError struct {
+	Expr     string   // The expression of the clause.
+	Pos      int      // Byte offset in Expr of the problem.
+	Msg      string   // The problem, e.g. "unexpected identifier B".
+	Expected []string // What could have been at Pos instead, if known.
+}
+
+// Column returns the column of the problem in Expr, counting runes from 1.
+func (e *ParseError) Column() int {
+	if e.Pos > len(e.Expr) {
+		return e.Pos + 1
+	}
+	return utf8.RuneCountInString(e.Expr[:e.Pos]) + 1
+}
+
+// Error describes the problem, followed by the expression with a caret under
+// the character where it is, e.g.
+//
+//	could not be parsed: unexpected end of refinement, expected ... at column 4
+//	    A >
+//	       ^
+func (e *ParseError) Error() string {
+	return ErrParse.Error() + ": " + e.describe() + carets(e.Expr, e)
+}
+
+func (e *ParseError) Unwrap() error {
+	return ErrParse
+}
+
+// describe describes the problem without showing where it is in Expr.
+func (e *ParseError) describe() string {
+	msg := e.Msg
+	switch len(e.Expected) {
+	case 0:
+	case 1:
+		msg += ", expected " + e.Expected[0]
+	default:
+		msg += ", expected one of " + strings.Join(e.Expected, ", ")
+	}
+	return msg + " at column " + strconv.Itoa(e.Column())
+}
+
+// ParseErrors are the errors found in the expression of a clause when there
+// are several, in the order of their positions. They wrap ErrParse, and
+// errors.As finds the first of them.
+type ParseErrors []*ParseError
+
+// Error describes each problem in turn, followed by the expression with a
+// caret under each of them.
+func (e ParseErrors) Error() string {
+	if len(e) == 0 {
+		return ErrParse.Error()
+	}
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.describe()
+	}
+	return ErrParse.Error() + ": " + strings.Join(msgs, "; ") + carets(e[0].Expr, e...)
+}
+
+func (e ParseErrors) Is(target error) bool {
+	return target == ErrParse
+}
+
+func (e ParseErrors) As(target any) bool {
+	for _, pe := range e {
+		if errors.As(pe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// carets renders expr on a line of its own, with a caret under the position
+// of each error on the next, or returns "" if a position isn't in expr.
+func carets(expr string, errs ...*ParseError) string {
+	if expr == "" {
+		return ""
+	}
+	var b strings.Builder
+	last := 0
+	for _, pe := range errs {
+		if pe.Pos < last || pe.Pos > len(expr) {
+			return ""
+		}
+		b.WriteString(pad(expr[last:pe.Pos]) + "^")
+		_, width := utf8.DecodeRuneInString(expr[pe.Pos:])
+		last = pe.Pos + width
+	}
+	return "\n    " + expr + "\n    " + b.String()
+}
+
+// pad returns white space as wide as s, keeping its tabs, to align what
+// follows it with the character after s on the line above.
+func pad(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\t' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
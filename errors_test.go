@@ -0,0 +1,116 @@
+package refine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testCodeError struct {
+	code string
+}
+
+func (e testCodeError) Error() string {
+	return "code " + e.code
+}
+
+func TestErrors(t *testing.T) {
+	errs := Errors{
+		fmt.Errorf("first: %w", ErrParse),
+		fmt.Errorf("second: %w", testCodeError{"a"}),
+		testCodeError{"b"},
+	}
+
+	if got, want := errs.Error(), "first: could not be parsed\nsecond: code a\ncode b"; got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+
+	var err error = errs
+	if !errors.Is(err, ErrParse) {
+		t.Fatalf("got errors.Is(%v, ErrParse) false; want true", err)
+	}
+	if errors.Is(err, ErrNotMet) {
+		t.Fatalf("got errors.Is(%v, ErrNotMet) true; want false", err)
+	}
+
+	var ce testCodeError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got errors.As(%v) false; want true", err)
+	}
+	if ce.code != "a" {
+		t.Fatalf("got code %q; want the first, %q", ce.code, "a")
+	}
+
+	// Errors can be wrapped like any other error.
+	if !errors.Is(fmt.Errorf("wrapped: %w", err), ErrParse) {
+		t.Fatal("got errors.Is false through a wrapper; want true")
+	}
+	if errors.Is(Errors(nil), ErrParse) {
+		t.Fatal("got errors.Is true for no errors; want false")
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value any
+
+		want *FieldError
+	}{
+		{"NotMet", testAccount{ID: -1}, &FieldError{
+			Struct: "testAccount", Field: "ID", Path: "testAccount.ID", Value: -1,
+			Refinement: "ID >= 0", Kind: KindNotMet, Clause: 0, Offset: 0,
+		}},
+		{"Clause", testSignup{Name: "abcdef", Email: "a@example.com", Tags: []int{}}, &FieldError{
+			Struct: "testSignup", Field: "Name", Path: "testSignup.Name", Value: "abcdef",
+			Refinement: "len(Name) < 5", Kind: KindNotMet, Clause: 1, Offset: 15,
+		}},
+		{"Nested", testSignup{Name: "a", Email: "a@example.com", Tags: []int{}, Items: []testItem{{Quantity: 1, Price: -1}}}, &FieldError{
+			Struct: "testItem", Field: "Price", Path: "testSignup.Items[0].Price", Value: -1,
+			Refinement: "Price >= 0", Kind: KindNotMet,
+		}},
+		{"Parse", struct {
+			A int `refine:"A > 0; A >"`
+		}{A: 1}, &FieldError{
+			Field: "A", Path: ".A", Value: 1, Refinement: "A >", Kind: KindParse, Clause: 1, Offset: 7,
+		}},
+		{"Eval", struct {
+			A any `refine:"A > 0"`
+		}{A: 1}, &FieldError{
+			Field: "A", Path: ".A", Value: 1, Refinement: "A > 0", Kind: KindEval,
+		}},
+		{"Options", struct {
+			A *int `refine:",omitempty,required"`
+		}{}, &FieldError{
+			Field: "A", Path: ".A", Refinement: ",omitempty,required", Kind: KindParse,
+		}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckAll(tc.value)
+			var got *FieldError
+			if !errors.As(err, &got) {
+				t.Fatalf("got %v; want a *FieldError", err)
+			}
+			got.resolved, got.message, got.code, got.err = "", "", "", nil
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+
+	err := Check(testAccount{ID: 7}, Groups("update"))
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v; want a *FieldError", err)
+	}
+	if fe.Field != "" || fe.Path != "testAccount" || fe.Value != nil || fe.Refinement != "update: ID != 7" {
+		t.Fatalf("got %+v; want an error for the struct", fe)
+	}
+	if fe.Kind.String() != "not met" {
+		t.Fatalf("got kind %v; want not met", fe.Kind)
+	}
+}
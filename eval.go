@@ -3,6 +3,8 @@ package refine
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 )
 
 type kind int
@@ -19,17 +21,90 @@ const (
 	boxMap
 	boxPointer
 	boxStruct
+	boxUntypedIntConstant
+	boxBigInt
+	boxBigFloat
+	boxBigRat
+	boxList
+	boxArray
+	// boxUnsupported is the value of a field whose type can't be evaluated.
+	boxUnsupported
 )
 
 type box struct {
 	kind kind
 	val  any
+	// typ is the Go type the value was read from, or nil for constants and
+	// the results of operations.
+	typ reflect.Type
+	// dynamic is set for values read through an interface that have not been
+	// narrowed by an is expression.
+	dynamic bool
+	// bits is the size of the integer type the value was read from, or of
+	// the operands it was computed from, if it is narrower than int or uint.
+	bits int
+}
+
+var errNotNarrowed = errors.New("refine.eval: interface values must be narrowed with 'is' before use")
+
+// builtin is a function that can be called by name from a refinement.
+type builtin func(args []box) (box, error)
+
+// builtins are the functions available to every refinement.
+var builtins = map[string]builtin{
+	"bigInt":   bigBuiltin(boxBigInt),
+	"bigFloat": bigBuiltin(boxBigFloat),
+	"bigRat":   bigBuiltin(boxBigRat),
+
+	"deepEqual": builtinDeepEqual,
+	"len":       builtinLen,
+}
+
+// quantifiers are called like builtins, but bind each element of a slice,
+// array or list to a symbol while evaluating a predicate, e.g.
+// all(Scores, s, s >= 0). all is true if the predicate holds for every
+// element, and any if it holds for at least one.
+var quantifiers = map[string]bool{
+	"all": true,
+	"any": false,
+}
+
+func builtinLen(args []box) (box, error) {
+	if len(args) != 1 {
+		return box{}, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	var n int
+	switch arg := args[0]; arg.kind {
+	case boxString:
+		n = len(arg.val.(string))
+	case boxList:
+		n = len(arg.val.([]box))
+	case boxSlice, boxArray, boxMap:
+		n = arg.value().Len()
+	default:
+		return box{}, fmt.Errorf("invalid argument: kind %d has no length", arg.kind)
+	}
+
+	return box{kind: boxInt, val: n}, nil
 }
 
 type evaluator struct {
 	symbols map[string]box
-	Result  box
-	Err     error
+	// overflow makes signed integer overflow an error.
+	overflow bool
+	// ignoreUnexported makes unexported fields impossible to select.
+	ignoreUnexported bool
+	// funcs finds the Go functions registered for use in refinements.
+	funcs func(string) (reflect.Value, bool)
+	// notes are the rules broken by the values given to functions, which
+	// explain why a refinement is not met.
+	notes []string
+	// known are the results of subexpressions that have already been
+	// evaluated, which are used rather than evaluating them again.
+	known  map[expression]step
+	Result box
+	Err    error
 }
 
 func newEvaluator() *evaluator {
@@ -47,18 +122,130 @@ func newEvaluator() *evaluator {
 	return ev
 }
 
+// coerceUntypedInt converts an untyped integer constant on either side of a
+// binary operation to the kind of the other side. Untyped constants that meet
+// a non-numeric kind, or each other, default to boxInt.
+func coerceUntypedInt(left, right box) (box, box, error) {
+	var err error
+	if left.kind == boxUntypedIntConstant {
+		left, err = convertUntypedInt(left, right.kind)
+		if err != nil {
+			return box{}, box{}, err
+		}
+	}
+	if right.kind == boxUntypedIntConstant {
+		right, err = convertUntypedInt(right, left.kind)
+		if err != nil {
+			return box{}, box{}, err
+		}
+	}
+	return left, right, nil
+}
+
+// convertUntypedInt converts an untyped integer constant to the kind k.
+func convertUntypedInt(b box, k kind) (box, error) {
+	switch {
+	case isBig(k):
+		return toBig(k, b)
+	case k == boxUint:
+		if b.val.(int) < 0 {
+			return box{}, fmt.Errorf("constant %d overflows uint", b.val.(int))
+		}
+		return box{kind: k, val: uint(b.val.(int))}, nil
+	case k == boxFloat32:
+		return box{kind: k, val: float32(b.val.(int))}, nil
+	case k == boxFloat64:
+		return box{kind: k, val: float64(b.val.(int))}, nil
+	default:
+		return box{kind: boxInt, val: b.val}, nil
+	}
+}
+
+// errMismatch reports that two boxes can't be used together. The Go types of
+// the values are used to describe them where they are known.
+func errMismatch(left, right box) error {
+	if left.typ != nil && right.typ != nil {
+		return fmt.Errorf("type mismatch: %s != %s", left.typ, right.typ)
+	}
+	return fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+}
+
+// namedMismatch reports whether left and right were read from values of
+// different named types.
+func namedMismatch(left, right box) bool {
+	return left.typ != nil && right.typ != nil && left.typ != right.typ &&
+		left.typ.Name() != "" && right.typ.Name() != ""
+}
+
+// isNil reports whether x is nil or holds a nil slice, map or pointer.
+func isNil(x any) bool {
+	if x == nil {
+		return true
+	}
+	v, ok := x.(reflect.Value)
+	if !ok {
+		v = reflect.ValueOf(x)
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// samePointer reports whether x and y, which are pointers or reflect.Values
+// holding them, point to the same address as the same type. A nil x or y is
+// only the same as another nil pointer.
+func samePointer(x, y any) bool {
+	if x == nil || y == nil {
+		return isNil(x) == isNil(y)
+	}
+	vx, ok := x.(reflect.Value)
+	if !ok {
+		vx = reflect.ValueOf(x)
+	}
+	vy, ok := y.(reflect.Value)
+	if !ok {
+		vy = reflect.ValueOf(y)
+	}
+	return vx.Type() == vy.Type() && vx.Pointer() == vy.Pointer()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// typeMatches reports whether t is the type named by an is expression. Named
+// types match with or without their package name, and the names any and error
+// match any type and types implementing error respectively.
+func typeMatches(t reflect.Type, name string) bool {
+	switch {
+	case name == "any":
+		return true
+	case name == "error":
+		return t.Implements(errorType)
+	case strings.HasPrefix(name, "*"):
+		return t.Kind() == reflect.Pointer && typeMatches(t.Elem(), name[1:])
+	case strings.HasPrefix(name, "[]"):
+		return t.Kind() == reflect.Slice && t.Name() == "" && typeMatches(t.Elem(), name[2:])
+	}
+	return t.String() == name || (t.PkgPath() != "" && t.Name() == name)
+}
+
 func evalMultiply(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 	var v any
 	switch left.kind {
 	case boxInt:
 		v = left.val.(int) * right.val.(int)
+	case boxUint:
+		v = left.val.(uint) * right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) * right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) * right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryMultiply, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -68,17 +255,41 @@ func evalMultiply(left, right box) (box, error) {
 
 func evalDivide(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v any
 	switch left.kind {
 	case boxInt:
 		v = left.val.(int) / right.val.(int)
+	case boxUint:
+		v = left.val.(uint) / right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) / right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) / right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryDivide, left, right)
+	default:
+		return box{}, errors.New("invalid type!")
+	}
+
+	return box{kind: left.kind, val: v}, nil
+}
+
+func evalModulo(left, right box) (box, error) {
+	if left.kind != right.kind {
+		return box{}, errMismatch(left, right)
+	}
+
+	var v any
+	switch left.kind {
+	case boxInt:
+		v = left.val.(int) % right.val.(int)
+	case boxUint:
+		v = left.val.(uint) % right.val.(uint)
+	case boxBigInt:
+		return bigArith(binaryModulo, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -88,7 +299,7 @@ func evalDivide(left, right box) (box, error) {
 
 func evalAdd(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v any
@@ -97,10 +308,14 @@ func evalAdd(left, right box) (box, error) {
 		v = left.val.(string) + right.val.(string)
 	case boxInt:
 		v = left.val.(int) + right.val.(int)
+	case boxUint:
+		v = left.val.(uint) + right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) + right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) + right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryPlus, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -110,17 +325,21 @@ func evalAdd(left, right box) (box, error) {
 
 func evalSubtract(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v any
 	switch left.kind {
 	case boxInt:
 		v = left.val.(int) - right.val.(int)
+	case boxUint:
+		v = left.val.(uint) - right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) - right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) - right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryMinus, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -130,13 +349,17 @@ func evalSubtract(left, right box) (box, error) {
 
 func evalLeftShift(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v any
 	switch left.kind {
 	case boxInt:
 		v = left.val.(int) << right.val.(int)
+	case boxUint:
+		v = left.val.(uint) << right.val.(uint)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryLeftShift, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -146,13 +369,17 @@ func evalLeftShift(left, right box) (box, error) {
 
 func evalRightShift(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v any
 	switch left.kind {
 	case boxInt:
 		v = left.val.(int) >> right.val.(int)
+	case boxUint:
+		v = left.val.(uint) >> right.val.(uint)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigArith(binaryRightShift, left, right)
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -161,8 +388,17 @@ func evalRightShift(left, right box) (box, error) {
 }
 
 func evalEqual(left, right box) (box, error) {
+	// List literals are compared element by element with slices and arrays.
+	if left.kind == boxList || right.kind == boxList {
+		eq, err := equalBoxes(left, right, false)
+		if err != nil {
+			return box{}, err
+		}
+		return box{kind: boxBool, val: eq}, nil
+	}
+
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -171,14 +407,30 @@ func evalEqual(left, right box) (box, error) {
 		v = left.val.(string) == right.val.(string)
 	case boxInt:
 		v = left.val.(int) == right.val.(int)
+	case boxUint:
+		v = left.val.(uint) == right.val.(uint)
+	case boxFloat32:
+		v = left.val.(float32) == right.val.(float32)
+	case boxFloat64:
+		v = left.val.(float64) == right.val.(float64)
 	case boxBool:
 		v = left.val.(bool) == right.val.(bool)
-	case boxSlice:
-		v = left.val == right.val
-	case boxMap:
-		v = left.val == right.val
+	case boxSlice, boxArray, boxMap, boxStruct:
+		// Comparisons against the nil constant only test for nil, while
+		// other values are compared element by element.
+		if left.val == nil || right.val == nil {
+			v = isNil(left.val) == isNil(right.val)
+			break
+		}
+		eq, err := equalBoxes(left, right, false)
+		if err != nil {
+			return box{}, err
+		}
+		v = eq
 	case boxPointer:
-		v = left.val == right.val
+		v = samePointer(left.val, right.val)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) == 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -190,8 +442,17 @@ func evalEqual(left, right box) (box, error) {
 }
 
 func evalNotEqual(left, right box) (box, error) {
+	// List literals are compared element by element with slices and arrays.
+	if left.kind == boxList || right.kind == boxList {
+		eq, err := equalBoxes(left, right, false)
+		if err != nil {
+			return box{}, err
+		}
+		return box{kind: boxBool, val: !eq}, nil
+	}
+
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -200,14 +461,30 @@ func evalNotEqual(left, right box) (box, error) {
 		v = left.val.(string) != right.val.(string)
 	case boxInt:
 		v = left.val.(int) != right.val.(int)
+	case boxUint:
+		v = left.val.(uint) != right.val.(uint)
+	case boxFloat32:
+		v = left.val.(float32) != right.val.(float32)
+	case boxFloat64:
+		v = left.val.(float64) != right.val.(float64)
 	case boxBool:
 		v = left.val.(bool) != right.val.(bool)
-	case boxSlice:
-		v = left.val != right.val
-	case boxMap:
-		v = left.val != right.val
+	case boxSlice, boxArray, boxMap, boxStruct:
+		// Comparisons against the nil constant only test for nil, while
+		// other values are compared element by element.
+		if left.val == nil || right.val == nil {
+			v = isNil(left.val) != isNil(right.val)
+			break
+		}
+		eq, err := equalBoxes(left, right, false)
+		if err != nil {
+			return box{}, err
+		}
+		v = !eq
 	case boxPointer:
-		v = left.val != right.val
+		v = !samePointer(left.val, right.val)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) != 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -220,7 +497,7 @@ func evalNotEqual(left, right box) (box, error) {
 
 func evalLessThan(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -229,10 +506,14 @@ func evalLessThan(left, right box) (box, error) {
 		v = left.val.(string) < right.val.(string)
 	case boxInt:
 		v = left.val.(int) < right.val.(int)
+	case boxUint:
+		v = left.val.(uint) < right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) < right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) < right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) < 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -242,7 +523,7 @@ func evalLessThan(left, right box) (box, error) {
 
 func evalLessThanOrEqual(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -251,10 +532,14 @@ func evalLessThanOrEqual(left, right box) (box, error) {
 		v = left.val.(string) <= right.val.(string)
 	case boxInt:
 		v = left.val.(int) <= right.val.(int)
+	case boxUint:
+		v = left.val.(uint) <= right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) <= right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) <= right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) <= 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -264,7 +549,7 @@ func evalLessThanOrEqual(left, right box) (box, error) {
 
 func evalGreaterThan(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -273,10 +558,14 @@ func evalGreaterThan(left, right box) (box, error) {
 		v = left.val.(string) > right.val.(string)
 	case boxInt:
 		v = left.val.(int) > right.val.(int)
+	case boxUint:
+		v = left.val.(uint) > right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) > right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) > right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) > 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -286,7 +575,7 @@ func evalGreaterThan(left, right box) (box, error) {
 
 func evalGreaterThanOrEqual(left, right box) (box, error) {
 	if left.kind != right.kind {
-		return box{}, fmt.Errorf("type mismatch: %d != %d", left.kind, right.kind)
+		return box{}, errMismatch(left, right)
 	}
 
 	var v bool
@@ -295,10 +584,14 @@ func evalGreaterThanOrEqual(left, right box) (box, error) {
 		v = left.val.(string) >= right.val.(string)
 	case boxInt:
 		v = left.val.(int) >= right.val.(int)
+	case boxUint:
+		v = left.val.(uint) >= right.val.(uint)
 	case boxFloat32:
 		v = left.val.(float32) >= right.val.(float32)
 	case boxFloat64:
 		v = left.val.(float64) >= right.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		v = bigCmp(left, right) >= 0
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -321,12 +614,17 @@ func evalUnaryNot(val box) (box, error) {
 func evalUnaryMinus(val box) (box, error) {
 	var v any
 	switch val.kind {
-	case boxInt:
+	case boxInt, boxUntypedIntConstant:
 		v = -val.val.(int)
+	case boxUint:
+		// Unsigned integers wrap around, as in Go.
+		v = -val.val.(uint)
 	case boxFloat32:
 		v = -val.val.(float32)
 	case boxFloat64:
 		v = -val.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return bigNeg(val), nil
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -337,12 +635,14 @@ func evalUnaryMinus(val box) (box, error) {
 func evalUnaryPlus(val box) (box, error) {
 	var v any
 	switch val.kind {
-	case boxInt:
+	case boxInt, boxUntypedIntConstant:
 		v = +val.val.(int)
 	case boxFloat32:
 		v = +val.val.(float32)
 	case boxFloat64:
 		v = +val.val.(float64)
+	case boxBigInt, boxBigFloat, boxBigRat:
+		return val, nil
 	default:
 		return box{}, errors.New("invalid type!")
 	}
@@ -364,13 +664,15 @@ func (e *evaluator) VisitBooleanExpression(be *booleanExpression) {
 }
 
 func (e *evaluator) VisitIntegerExpression(ie *integerExpression) {
-	e.Result, e.Err = box{kind: boxInt, val: ie.value}, nil
+	e.Result, e.Err = box{kind: boxUntypedIntConstant, val: ie.value}, nil
 }
 
 func (e *evaluator) VisitSymbolExpression(se *symbolExpression) {
 	var val, ok = e.symbols[se.text]
 	if !ok {
 		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: couldn't find value for symbol %s", se.text)
+	} else if val.kind == boxUnsupported {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: %s has %w %s", se.text, ErrUnsupportedType, val.typ.Kind())
 	} else {
 		e.Result, e.Err = val, nil
 	}
@@ -380,19 +682,344 @@ func (e *evaluator) VisitStringExpression(se *stringExpression) {
 	e.Result, e.Err = box{kind: boxString, val: se.text}, nil
 }
 
+func (e *evaluator) VisitListExpression(le *listExpression) {
+	elems := make([]box, 0, len(le.elems))
+	for _, elem := range le.elems {
+		e.accept(elem)
+		if e.Err != nil {
+			return
+		}
+		elems = append(elems, e.Result)
+	}
+	e.Result, e.Err = box{kind: boxList, val: elems}, nil
+}
+
 func (e *evaluator) VisitSelectorExpression(se *selectorExpression) {
-	e.Result, e.Err = box{}, errors.New("selectors are unimplemented!")
+	e.accept(se.expr)
+	if e.Err != nil {
+		return
+	}
+	e.Result, e.Err = selectField(e.Result, se.selection.text, e.ignoreUnexported)
+	if e.Err != nil && e.Err != errNotNarrowed {
+		e.Err = fmt.Errorf("refine.eval: %w", e.Err)
+	}
+}
+
+func (e *evaluator) VisitCallExpression(ce *callExpression) {
+	if sel, ok := ce.fn.(*selectorExpression); ok {
+		e.visitMethodCall(sel, ce.args)
+		return
+	}
+
+	sym, ok := ce.fn.(*symbolExpression)
+	if !ok {
+		e.Result, e.Err = box{}, errors.New("refine.eval: only named functions can be called")
+		return
+	}
+
+	if want, ok := quantifiers[sym.text]; ok {
+		e.visitQuantifier(sym.text, want, ce.args)
+		return
+	}
+
+	fn, ok := builtins[sym.text]
+	if !ok {
+		e.visitFuncCall(sym.text, ce.args)
+		return
+	}
+
+	args, ok := e.evalArgs(ce.args)
+	if !ok {
+		return
+	}
+
+	e.Result, e.Err = fn(args)
+	if e.Err != nil {
+		e.Err = fmt.Errorf("refine.eval: %s: %w", sym.text, e.Err)
+	}
+}
+
+// visitFuncCall calls a registered Go function.
+func (e *evaluator) visitFuncCall(name string, argExprs []expression) {
+	var fn reflect.Value
+	var ok bool
+	if e.funcs != nil {
+		fn, ok = e.funcs(name)
+	}
+	if !ok {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: couldn't find function %s", name)
+		return
+	}
+
+	args, ok := e.evalArgs(argExprs)
+	if !ok {
+		return
+	}
+
+	e.Result, e.Err = call(name, fn, args)
+	var re *ruleError
+	if errors.As(e.Err, &re) {
+		e.Result, e.Err = box{kind: boxBool, val: false}, nil
+		e.notes = append(e.notes, re.Error())
+	}
+	if e.Err != nil && !errors.Is(e.Err, ErrEval) {
+		e.Err = fmt.Errorf("refine.eval: %w", e.Err)
+	}
+}
+
+// visitMethodCall calls a Go method on the value of a field, e.g.
+// Version.Major(). Methods are called like any other Go code, so those of
+// pointers can modify the values being checked.
+func (e *evaluator) visitMethodCall(sel *selectorExpression, argExprs []expression) {
+	e.accept(sel.expr)
+	if e.Err != nil {
+		return
+	}
+	recv := e.Result
+
+	args, ok := e.evalArgs(argExprs)
+	if !ok {
+		return
+	}
+
+	e.Result, e.Err = callMethod(recv, sel.selection.text, args)
+	if e.Err != nil && !errors.Is(e.Err, ErrEval) {
+		e.Err = fmt.Errorf("refine.eval: %w", e.Err)
+	}
+}
+
+// evalArgs evaluates the arguments of a call in order, stopping at the first
+// error.
+func (e *evaluator) evalArgs(exprs []expression) ([]box, bool) {
+	args := make([]box, 0, len(exprs))
+	for _, arg := range exprs {
+		e.accept(arg)
+		if e.Err != nil {
+			return nil, false
+		}
+		args = append(args, e.Result)
+	}
+	return args, true
+}
+
+// visitQuantifier evaluates all or any. The predicate is evaluated for each
+// element until one of them gives a result other than want.
+func (e *evaluator) visitQuantifier(name string, want bool, args []expression) {
+	if len(args) != 3 {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: %s: expected 3 arguments, got %d", name, len(args))
+		return
+	}
+	bind, ok := args[1].(*symbolExpression)
+	if !ok {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: %s: second argument must be a name", name)
+		return
+	}
+
+	e.accept(args[0])
+	if e.Err != nil {
+		return
+	}
+	if e.Result.dynamic {
+		e.Result, e.Err = box{}, errNotNarrowed
+		return
+	}
+	elems, err := elements(e.Result)
+	if err != nil {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: %s: %w", name, err)
+		return
+	}
+
+	saved, shadowed := e.symbols[bind.text]
+	defer func() {
+		if shadowed {
+			e.symbols[bind.text] = saved
+		} else {
+			delete(e.symbols, bind.text)
+		}
+	}()
+
+	for _, elem := range elems {
+		e.symbols[bind.text] = elem
+		e.accept(args[2])
+		if e.Err != nil {
+			return
+		}
+		if e.Result.kind != boxBool {
+			e.Result, e.Err = box{}, fmt.Errorf("refine.eval: %s: predicate must be bool", name)
+			return
+		}
+		if e.Result.val.(bool) != want {
+			e.Result, e.Err = box{kind: boxBool, val: !want}, nil
+			return
+		}
+	}
+	e.Result, e.Err = box{kind: boxBool, val: want}, nil
+}
+
+func (e *evaluator) VisitIndexExpression(ie *indexExpression) {
+	e.accept(ie.expr)
+	if e.Err != nil {
+		return
+	}
+	x := e.Result
+
+	e.accept(ie.index)
+	if e.Err != nil {
+		return
+	}
+	index := e.Result
+
+	if x.dynamic || index.dynamic {
+		e.Result, e.Err = box{}, errNotNarrowed
+		return
+	}
+
+	var i int
+	switch index.kind {
+	case boxInt, boxUntypedIntConstant:
+		i = index.val.(int)
+	case boxUint:
+		i = int(index.val.(uint))
+	default:
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: invalid index of kind %d", index.kind)
+		return
+	}
+
+	var n int
+	switch x.kind {
+	case boxString:
+		n = len(x.val.(string))
+	case boxList:
+		n = len(x.val.([]box))
+	case boxSlice, boxArray:
+		n = x.value().Len()
+	default:
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: cannot index kind %d", x.kind)
+		return
+	}
+	if i < 0 || i >= n {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: index %d out of range [0:%d]", i, n)
+		return
+	}
+
+	switch x.kind {
+	case boxString:
+		e.Result, e.Err = boxValue(reflect.ValueOf(x.val.(string)[i]))
+	case boxList:
+		e.Result, e.Err = x.val.([]box)[i], nil
+	default:
+		e.Result, e.Err = boxValue(x.value().Index(i))
+	}
+}
+
+func (e *evaluator) VisitIsExpression(ie *isExpression) {
+	e.accept(ie.expr)
+	if e.Err != nil {
+		return
+	}
+
+	// Nil interfaces hold no value, so they are not of any type.
+	match := e.Result.kind != boxUntypedNilConstant && e.Result.typ != nil && typeMatches(e.Result.typ, ie.typ)
+	e.Result, e.Err = box{kind: boxBool, val: match}, nil
+}
+
+// narrow marks the symbols tested by is expressions in a conjunction as no
+// longer dynamic, so that they can be used as the type they were tested
+// against. It returns a function that restores the symbols.
+func (e *evaluator) narrow(expr expression) func() {
+	switch expr := expr.(type) {
+	case *isExpression:
+		sym, ok := expr.expr.(*symbolExpression)
+		if !ok {
+			break
+		}
+		saved, ok := e.symbols[sym.text]
+		if !ok || !saved.dynamic {
+			break
+		}
+		narrowed := saved
+		narrowed.dynamic = false
+		e.symbols[sym.text] = narrowed
+		return func() {
+			e.symbols[sym.text] = saved
+		}
+	case *binaryExpression:
+		if expr.op != binaryLogicalAnd {
+			break
+		}
+		restoreLeft := e.narrow(expr.left)
+		restoreRight := e.narrow(expr.right)
+		return func() {
+			restoreRight()
+			restoreLeft()
+		}
+	}
+	return func() {}
+}
+
+// visitLogical evaluates && and || with short-circuiting. The right operand
+// of && is evaluated with the values tested by is expressions on the left
+// narrowed to the types they were tested against.
+func (e *evaluator) visitLogical(be *binaryExpression) {
+	e.accept(be.left)
+	if e.Err != nil {
+		return
+	}
+	if e.Result.kind != boxBool {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: operands of %s must be bool", binarySymbols[be.op])
+		return
+	}
+
+	left := e.Result.val.(bool)
+	if (be.op == binaryLogicalAnd && !left) || (be.op == binaryLogicalOr && left) {
+		e.Result, e.Err = box{kind: boxBool, val: left}, nil
+		return
+	}
+
+	if be.op == binaryLogicalAnd {
+		restore := e.narrow(be.left)
+		defer restore()
+	}
+
+	e.accept(be.right)
+	if e.Err != nil {
+		return
+	}
+	if e.Result.kind != boxBool {
+		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: operands of %s must be bool", binarySymbols[be.op])
+		return
+	}
+	e.Result = box{kind: boxBool, val: e.Result.val.(bool)}
 }
 
 func (e *evaluator) VisitUnaryExpression(ue *unaryExpression) {
-	ue.expr.Accept(e)
+	e.accept(ue.expr)
 	if e.Err != nil {
 		return
 	}
 
+	if e.Result.dynamic {
+		e.Result, e.Err = box{}, errNotNarrowed
+		return
+	}
+
 	switch ue.op {
 	case unaryMinus:
-		e.Result, e.Err = evalUnaryMinus(e.Result)
+		val := e.Result
+		if e.overflow {
+			if err := checkNegate(val); err != nil {
+				e.Result, e.Err = box{}, err
+				return
+			}
+		}
+		e.Result, e.Err = evalUnaryMinus(val)
+		if e.Err == nil {
+			var wrapped bool
+			e.Result, wrapped = truncate(e.Result, val)
+			if wrapped && e.overflow {
+				e.Result, e.Err = box{}, &ArithmeticError{Op: "-", Right: val.val, Err: ErrOverflow}
+			}
+		}
 	case unaryPlus:
 		e.Result, e.Err = evalUnaryPlus(e.Result)
 	case unaryNot:
@@ -403,18 +1030,54 @@ func (e *evaluator) VisitUnaryExpression(ue *unaryExpression) {
 }
 
 func (e *evaluator) VisitBinaryExpression(be *binaryExpression) {
-	be.left.Accept(e)
+	if be.op == binaryLogicalAnd || be.op == binaryLogicalOr {
+		e.visitLogical(be)
+		return
+	}
+
+	e.accept(be.left)
 	if e.Err != nil {
 		return
 	}
 	left := e.Result
 
-	be.right.Accept(e)
+	e.accept(be.right)
 	if e.Err != nil {
 		return
 	}
 	right := e.Result
 
+	// Values read through an interface can be compared for equality, as in
+	// Go, but must be narrowed before being used with other operators. A
+	// non-nil interface is never equal to nil, even if it holds a nil pointer.
+	dynamic := left.dynamic || right.dynamic
+	if dynamic {
+		if be.op != binaryEqual && be.op != binaryNotEqual {
+			e.Result, e.Err = box{}, errNotNarrowed
+			return
+		}
+		if left.kind == boxUntypedNilConstant || right.kind == boxUntypedNilConstant {
+			eq := left.kind == right.kind
+			e.Result, e.Err = box{kind: boxBool, val: eq == (be.op == binaryEqual)}, nil
+			return
+		}
+	}
+
+	// Values of different named types can't be compared, as in Go, although
+	// they are boxed as the same underlying type.
+	if !dynamic && (be.op == binaryEqual || be.op == binaryNotEqual) && namedMismatch(left, right) {
+		e.Result, e.Err = box{}, errMismatch(left, right)
+		return
+	}
+
+	// Big numbers are held by pointer, so compare them as pointers against nil.
+	if left.kind == boxUntypedNilConstant && isBig(right.kind) {
+		right.kind = boxPointer
+	}
+	if right.kind == boxUntypedNilConstant && isBig(left.kind) {
+		left.kind = boxPointer
+	}
+
 	// Coerce nil constants from the left.
 	if left.kind == boxUntypedNilConstant && (right.kind == boxSlice || right.kind == boxMap || right.kind == boxPointer) {
 		left.kind = right.kind
@@ -425,11 +1088,54 @@ func (e *evaluator) VisitBinaryExpression(be *binaryExpression) {
 		right.kind = left.kind
 	}
 
+	// Coerce integer constants to the kind of the other operand.
+	left, right, err := coerceUntypedInt(left, right)
+	if err != nil {
+		e.Result, e.Err = box{}, err
+		return
+	}
+
+	// Shift counts can be of any integer type, as in Go, so a valid count
+	// takes on the kind of the value being shifted.
+	if (be.op == binaryLeftShift || be.op == binaryRightShift) && left.kind != right.kind &&
+		(left.kind == boxInt || left.kind == boxUint) && (right.kind == boxInt || right.kind == boxUint) {
+		if err := checkShift(be.op, left, right); err != nil {
+			e.Result, e.Err = box{}, err
+			return
+		}
+		right = shiftCount(right, left.kind)
+	}
+
+	// Interfaces holding values of different types are not equal.
+	if dynamic && (left.kind != right.kind || (left.typ != nil && right.typ != nil && left.typ != right.typ)) {
+		e.Result, e.Err = box{kind: boxBool, val: be.op == binaryNotEqual}, nil
+		return
+	}
+
+	// Reject operations that would panic or silently produce a wrong result.
+	if left.kind == right.kind {
+		switch be.op {
+		case binaryDivide, binaryModulo:
+			err = checkDivisor(be.op, left, right)
+		case binaryLeftShift, binaryRightShift:
+			err = checkShift(be.op, left, right)
+		}
+		if err == nil && e.overflow {
+			err = checkOverflow(be.op, left, right)
+		}
+		if err != nil {
+			e.Result, e.Err = box{}, err
+			return
+		}
+	}
+
 	switch be.op {
 	case binaryMultiply:
 		e.Result, e.Err = evalMultiply(left, right)
 	case binaryDivide:
 		e.Result, e.Err = evalDivide(left, right)
+	case binaryModulo:
+		e.Result, e.Err = evalModulo(left, right)
 	case binaryPlus:
 		e.Result, e.Err = evalAdd(left, right)
 	case binaryMinus:
@@ -453,6 +1159,31 @@ func (e *evaluator) VisitBinaryExpression(be *binaryExpression) {
 	default:
 		e.Result, e.Err = box{}, fmt.Errorf("refine.eval: unknown binary operator: %d!", be.op)
 	}
+
+	// Arithmetic on integers of types narrower than int or uint wraps
+	// around at the size of the type, as in Go.
+	if e.Err == nil {
+		var wrapped bool
+		e.Result, wrapped = truncate(e.Result, resultOperand(be.op, left, right))
+		if wrapped && e.overflow {
+			e.Result, e.Err = box{}, arithErr(be.op, left, right, ErrOverflow)
+		}
+	}
+}
+
+// accept evaluates expr, unless its result is already known. Notes only
+// explain why calls were false, so those from within expr are dropped if it
+// is true, as they can't be why the refinement is not met.
+func (e *evaluator) accept(expr expression) {
+	if s, ok := e.known[expr]; ok {
+		e.Result, e.Err = s.result, s.err
+		return
+	}
+	n := len(e.notes)
+	expr.Accept(e)
+	if e.Err == nil && e.Result.kind == boxBool && e.Result.val.(bool) {
+		e.notes = e.notes[:n]
+	}
 }
 
 // eval is a wrapper around passing the evaluator as a visitor to expr.
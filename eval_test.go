@@ -2,6 +2,7 @@ package refine
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -35,6 +36,37 @@ func TestEval(t *testing.T) {
 		}
 	}
 
+	var zeroExpr = func(op binaryOperator) *binaryExpression {
+		return &binaryExpression{
+			op: op,
+			left: &integerExpression{
+				text:  "11",
+				value: 11,
+			},
+			right: &integerExpression{
+				text:  "0",
+				value: 0,
+			},
+		}
+	}
+
+	var shiftExpr = func(op binaryOperator, count int) *binaryExpression {
+		return &binaryExpression{
+			op: op,
+			left: &integerExpression{
+				text:  "1",
+				value: 1,
+			},
+			right: &unaryExpression{
+				op: unaryPlus,
+				expr: &integerExpression{
+					text:  fmt.Sprint(count),
+					value: count,
+				},
+			},
+		}
+	}
+
 	testCases := []struct {
 		name string
 		expr expression
@@ -63,6 +95,11 @@ func TestEval(t *testing.T) {
 			expr:    binaryExpr(binaryDivide),
 			wantVal: box{kind: boxInt, val: 5},
 		},
+		{
+			name:    "binaryModulo",
+			expr:    binaryExpr(binaryModulo),
+			wantVal: box{kind: boxInt, val: 1},
+		},
 		{
 			name:    "binaryLeftShift",
 			expr:    binaryExpr(binaryLeftShift),
@@ -109,6 +146,26 @@ func TestEval(t *testing.T) {
 			expr:    errExpr(binaryPlus),
 			wantErr: errors.New("type mismatch: 2 != 1"),
 		},
+		{
+			name:    "binaryDivideByZero",
+			expr:    zeroExpr(binaryDivide),
+			wantErr: ErrDivideByZero,
+		},
+		{
+			name:    "binaryModuloByZero",
+			expr:    zeroExpr(binaryModulo),
+			wantErr: ErrDivideByZero,
+		},
+		{
+			name:    "binaryLeftShiftNegative",
+			expr:    shiftExpr(binaryLeftShift, -1),
+			wantErr: ErrShiftCount,
+		},
+		{
+			name:    "binaryRightShiftOversized",
+			expr:    shiftExpr(binaryRightShift, 64),
+			wantErr: ErrShiftCount,
+		},
 	}
 
 	for _, tc := range testCases {
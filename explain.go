@@ -0,0 +1,333 @@
+package refine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Explain makes the errors for refinements that aren't met, or can't be
+// evaluated, explain why: the text of the error is followed by the refinement
+// with the failing clause underlined, and the value of each subexpression of
+// the clause, e.g.
+//
+//	A > B && len(Name) < Max
+//	^^^^^^^^^^^^^^^^^^^^^^^^
+//	A > B && len(Name) < Max = false
+//	  A > B = false
+//	    A = 2
+//	    B = 2
+//	  len(Name) < Max (not evaluated)
+//
+// Explaining an error evaluates the clause again, so functions it calls are
+// called once more.
+func Explain() Option {
+	return func(c *config) {
+		c.explain = true
+	}
+}
+
+// step is a subexpression of a clause being explained, with its value.
+type step struct {
+	depth   int // Nesting in the clause, from 0 for the clause itself.
+	text    string
+	result  box
+	err     error
+	skipped bool // Not evaluated, as the operator short-circuited.
+}
+
+// recorder is a visitor that evaluates each subexpression of an expression
+// with an evaluator, from the bottom up, recording their values. Literals aren't recorded
+// as their values are in the text of the expression.
+type recorder struct {
+	ev    *evaluator
+	steps []step
+	depth int
+}
+
+// record records the operands of expr, then evaluates expr with their
+// results, so that each subexpression is only evaluated once.
+func (r *recorder) record(expr expression, operands ...expression) {
+	i := r.begin(expr)
+	for _, operand := range operands {
+		operand.Accept(r)
+	}
+	r.end(i, expr)
+}
+
+// begin adds the step for expr, whose operands are recorded after it.
+func (r *recorder) begin(expr expression) int {
+	r.steps = append(r.steps, step{depth: r.depth, text: exprString(expr)})
+	r.depth++
+	return len(r.steps) - 1
+}
+
+// end evaluates expr, the subject of step i, and records its result.
+func (r *recorder) end(i int, expr expression) {
+	r.depth--
+	expr.Accept(r.ev)
+	r.steps[i].result, r.steps[i].err = r.ev.Result, r.ev.Err
+	r.ev.known[expr] = r.steps[i]
+}
+
+func (r *recorder) VisitBooleanExpression(*booleanExpression) {}
+func (r *recorder) VisitIntegerExpression(*integerExpression) {}
+func (r *recorder) VisitStringExpression(*stringExpression)   {}
+
+func (r *recorder) VisitSymbolExpression(se *symbolExpression) {
+	if se.text != "nil" {
+		r.record(se)
+	}
+}
+
+func (r *recorder) VisitListExpression(le *listExpression) {
+	r.record(le, le.elems...)
+}
+
+func (r *recorder) VisitSelectorExpression(se *selectorExpression) {
+	r.record(se)
+}
+
+func (r *recorder) VisitCallExpression(ce *callExpression) {
+	if sym, ok := ce.fn.(*symbolExpression); ok {
+		if _, ok := quantifiers[sym.text]; ok {
+			// The predicate uses names that are only bound by the quantifier.
+			r.record(ce)
+			return
+		}
+	}
+	r.record(ce, ce.args...)
+}
+
+func (r *recorder) VisitIndexExpression(ie *indexExpression) {
+	r.record(ie, ie.expr, ie.index)
+}
+
+func (r *recorder) VisitIsExpression(ie *isExpression) {
+	r.record(ie, ie.expr)
+}
+
+func (r *recorder) VisitUnaryExpression(ue *unaryExpression) {
+	r.record(ue, ue.expr)
+}
+
+func (r *recorder) VisitBinaryExpression(be *binaryExpression) {
+	if be.op != binaryLogicalAnd && be.op != binaryLogicalOr {
+		r.record(be, be.left, be.right)
+		return
+	}
+
+	// The right operand is only evaluated if the left could be evaluated and
+	// doesn't decide the result, as it may only be valid if the left is true,
+	// e.g. P != nil && P.N > 0, and with the values tested by is expressions on
+	// the left of && narrowed, as it is by the evaluator.
+	i := r.begin(be)
+	be.left.Accept(r)
+	r.ev.accept(be.left)
+	left := r.ev.Result
+	if r.ev.Err == nil && left.kind == boxBool && left.val.(bool) != (be.op == binaryLogicalOr) {
+		restore := func() {}
+		if be.op == binaryLogicalAnd {
+			restore = r.ev.narrow(be.left)
+		}
+		be.right.Accept(r)
+		restore()
+	} else {
+		r.steps = append(r.steps, step{depth: r.depth, text: exprString(be.right), skipped: true})
+	}
+	r.end(i, be)
+}
+
+// explain evaluates expr, the clause cl of a refinement, again with ev and
+// renders the value of each of its subexpressions.
+func explain(ev *evaluator, refinement string, cl clause, expr expression) string {
+	r := &recorder{ev: ev}
+	ev.known = map[expression]step{}
+	expr.Accept(r)
+	ev.known = nil
+
+	var b strings.Builder
+	indent := "    "
+	start := cl.offset
+	if start > len(refinement) || !strings.HasPrefix(refinement[start:], cl.expr) {
+		// The clause isn't in the refinement, e.g. for an error with the
+		// text of a whole tag.
+		refinement, start = cl.expr, 0
+	}
+	fmt.Fprintf(&b, "%s%s\n", indent, refinement)
+	fmt.Fprintf(&b, "%s%s%s",
+		indent,
+		pad(refinement[:start]),
+		strings.Repeat("^", utf8.RuneCountInString(cl.expr)),
+	)
+
+	for _, s := range r.steps {
+		b.WriteString("\n" + indent + strings.Repeat("  ", s.depth) + s.text)
+		switch {
+		case s.skipped:
+			b.WriteString(" (not evaluated)")
+		case s.err != nil:
+			b.WriteString(": " + s.err.Error())
+		default:
+			b.WriteString(" = " + formatBox(s.result))
+		}
+	}
+	return b.String()
+}
+
+// formatBox formats a value for an explanation, with strings quoted.
+func formatBox(b box) string {
+	switch b.kind {
+	case boxString:
+		return strconv.Quote(b.val.(string))
+	case boxList:
+		elems := b.val.([]box)
+		s := make([]string, len(elems))
+		for i, elem := range elems {
+			s[i] = formatBox(elem)
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	case boxUntypedNilConstant:
+		return "nil"
+	}
+	return fmt.Sprint(b.original())
+}
+
+// binaryOperators are the symbols of the binary operators, with their
+// precedence.
+var binaryOperators = map[binaryOperator]struct {
+	symbol     string
+	precedence int
+}{
+	binaryLogicalOr:          {"||", 1},
+	binaryLogicalAnd:         {"&&", 2},
+	binaryEqual:              {"==", 3},
+	binaryNotEqual:           {"!=", 3},
+	binaryLessThan:           {"<", 3},
+	binaryLessThanOrEqual:    {"<=", 3},
+	binaryGreaterThan:        {">", 3},
+	binaryGreaterThanOrEqual: {">=", 3},
+	binaryPlus:               {"+", 4},
+	binaryMinus:              {"-", 4},
+	binaryLeftShift:          {"<<", 4},
+	binaryRightShift:         {">>", 4},
+	binaryMultiply:           {"*", 5},
+	binaryDivide:             {"/", 5},
+	binaryModulo:             {"%", 5},
+}
+
+var unaryOperators = map[unaryOperator]string{
+	unaryMinus:       "-",
+	unaryPlus:        "+",
+	unaryNot:         "!",
+	unaryDereference: "*",
+}
+
+// precedence returns the precedence of the operator of expr. Unary operators
+// have a higher precedence than binary ones, and selectors, calls and index
+// operations the highest.
+func precedence(expr expression) int {
+	switch e := expr.(type) {
+	case *binaryExpression:
+		return binaryOperators[e.op].precedence
+	case *isExpression:
+		return 3
+	case *unaryExpression:
+		return 6
+	}
+	return 7
+}
+
+// exprString formats an expression as it would be written in a refinement,
+// with parentheses only where they are needed.
+func exprString(expr expression) string {
+	p := &printer{}
+	expr.Accept(p)
+	return p.b.String()
+}
+
+// printer is a visitor that formats expressions.
+type printer struct {
+	b strings.Builder
+}
+
+// operand formats an operand of an operator of precedence prec. Binary
+// operators group to the right, so an operand on the left of one with the
+// same precedence needs parentheses.
+func (p *printer) operand(expr expression, prec int, left bool) {
+	if q := precedence(expr); q < prec || left && q == prec {
+		p.b.WriteString("(")
+		expr.Accept(p)
+		p.b.WriteString(")")
+		return
+	}
+	expr.Accept(p)
+}
+
+func (p *printer) list(exprs []expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.b.WriteString(", ")
+		}
+		expr.Accept(p)
+	}
+}
+
+func (p *printer) VisitBooleanExpression(be *booleanExpression) {
+	p.b.WriteString(be.text)
+}
+
+func (p *printer) VisitIntegerExpression(ie *integerExpression) {
+	p.b.WriteString(ie.text)
+}
+
+func (p *printer) VisitStringExpression(se *stringExpression) {
+	p.b.WriteString("`" + se.text + "`")
+}
+
+func (p *printer) VisitSymbolExpression(se *symbolExpression) {
+	p.b.WriteString(se.text)
+}
+
+func (p *printer) VisitListExpression(le *listExpression) {
+	p.b.WriteString("[")
+	p.list(le.elems)
+	p.b.WriteString("]")
+}
+
+func (p *printer) VisitSelectorExpression(se *selectorExpression) {
+	p.operand(se.expr, 7, false)
+	p.b.WriteString("." + se.selection.text)
+}
+
+func (p *printer) VisitCallExpression(ce *callExpression) {
+	p.operand(ce.fn, 7, false)
+	p.b.WriteString("(")
+	p.list(ce.args)
+	p.b.WriteString(")")
+}
+
+func (p *printer) VisitIndexExpression(ie *indexExpression) {
+	p.operand(ie.expr, 7, false)
+	p.b.WriteString("[")
+	ie.index.Accept(p)
+	p.b.WriteString("]")
+}
+
+func (p *printer) VisitIsExpression(ie *isExpression) {
+	p.operand(ie.expr, 3, true)
+	p.b.WriteString(" is " + ie.typ)
+}
+
+func (p *printer) VisitUnaryExpression(ue *unaryExpression) {
+	p.b.WriteString(unaryOperators[ue.op])
+	p.operand(ue.expr, 6, false)
+}
+
+func (p *printer) VisitBinaryExpression(be *binaryExpression) {
+	op := binaryOperators[be.op]
+	p.operand(be.left, op.precedence, true)
+	p.b.WriteString(" " + op.symbol + " ")
+	p.operand(be.right, op.precedence, false)
+}
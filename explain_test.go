@@ -0,0 +1,160 @@
+package refine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExprString(t *testing.T) {
+	testCases := []struct {
+		input string
+
+		want string
+	}{
+		{"A > B && len(Name) < Max", "A > B && len(Name) < Max"},
+		{"(A - B) - C", "(A - B) - C"},
+		{"A - (B - C)", "A - B - C"},
+		{"(A + B) * C", "(A + B) * C"},
+		{"A+B*C", "A + B * C"},
+		{"!(A || B) && C", "!(A || B) && C"},
+		{"-A.B[0]", "-A.B[0]"},
+		{"(-A).B", "(-A).B"},
+		{"(A == B) == C", "(A == B) == C"},
+		{"V is *refine.Error && $root.S != `x`", "V is *refine.Error && $root.S != `x`"},
+		{"all([1, 2], n, n > 0)", "all([1, 2], n, n > 0)"},
+		{"S.HasPrefix(`a`) == true", "S.HasPrefix(`a`) == true"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			expr, err := parse(lex(tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := exprString(expr)
+			if got != tc.want {
+				t.Fatalf("got %q; want %q", got, tc.want)
+			}
+
+			// The text parses back to the same expression.
+			again, err := parse(lex(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := exprString(again); s != got {
+				t.Fatalf("got %q after parsing %q", s, got)
+			}
+		})
+	}
+}
+
+func TestCheckExplain(t *testing.T) {
+	type pair struct {
+		A    int    `refine:"A > 0; A > B && len(Name) < Max"`
+		B    int    "refine:\"B != 0 || Name != ``\""
+		Name string "refine:\"Name != `` || B > 0\""
+		Max  int
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want string
+	}{
+		{"And", pair{A: 2, B: 2, Name: "ab", Max: 5}, `refine.Check: pair.A = 2, "A > B && len(Name) < Max" not met
+    A > 0; A > B && len(Name) < Max
+           ^^^^^^^^^^^^^^^^^^^^^^^^
+    A > B && len(Name) < Max = false
+      A > B = false
+        A = 2
+        B = 2
+      len(Name) < Max (not evaluated)`},
+		{"Or", pair{A: 3, B: 0, Name: "", Max: 5}, `refine.Check: pair.B = 0, "B != 0 || Name != ` + "``" + `" not met
+    B != 0 || Name != ` + "``" + `
+    ^^^^^^^^^^^^^^^^^^^^
+    B != 0 || Name != ` + "``" + ` = false
+      B != 0 = false
+        B = 0
+      Name != ` + "``" + ` = false
+        Name = ""`},
+		{"Call", pair{A: 3, B: 1, Name: "abcdef", Max: 5}, `refine.Check: pair.A = 3, "A > B && len(Name) < Max" not met
+    A > 0; A > B && len(Name) < Max
+           ^^^^^^^^^^^^^^^^^^^^^^^^
+    A > B && len(Name) < Max = false
+      A > B = true
+        A = 3
+        B = 1
+      len(Name) < Max = false
+        len(Name) = 6
+          Name = "abcdef"
+        Max = 5`},
+		{"Eval", struct {
+			V any `refine:"V > 0"`
+		}{V: 1}, `refine.Check: .V = 1, "V > 0" could not be evaluated: ` + errNotNarrowed.Error() + `
+    V > 0
+    ^^^^^
+    V > 0: ` + errNotNarrowed.Error() + `
+      V = 1`},
+		{"Narrowed", struct {
+			X any `refine:"X is int && X > 5"`
+		}{X: 3}, `refine.Check: .X = 3, "X is int && X > 5" not met
+    X is int && X > 5
+    ^^^^^^^^^^^^^^^^^
+    X is int && X > 5 = false
+      X is int = true
+        X = 3
+      X > 5 = false
+        X = 3`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(tc.value, Explain())
+			if err == nil {
+				t.Fatal("got <nil>; want an error")
+			}
+			if got := err.Error(); got != tc.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tc.want)
+			}
+
+			var fe *FieldError
+			if !errors.As(err, &fe) || !strings.HasSuffix(tc.want, fe.Explanation()) {
+				t.Fatalf("got explanation %q", fe.Explanation())
+			}
+		})
+	}
+
+	// Errors are only explained when asked.
+	err := Check(pair{A: 2, B: 2})
+	if err == nil || strings.Contains(err.Error(), "\n") {
+		t.Fatalf("got %q; want an error on one line", err)
+	}
+}
+
+func TestCheckExplainCalls(t *testing.T) {
+	calls := 0
+	c := NewChecker()
+	err := c.RegisterFunc("inc", func(n int) int {
+		calls++
+		return n + 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type nested struct {
+		N int `refine:"inc(inc(inc(N))) > 5"`
+	}
+	if err := c.Check(nested{N: 1}, Explain()); err == nil {
+		t.Fatal("got <nil>; want an error")
+	}
+
+	// Once to check the refinement, and once more to explain it.
+	if calls != 6 {
+		t.Fatalf("got %d calls; want 6", calls)
+	}
+}
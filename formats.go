@@ -0,0 +1,156 @@
+package refine
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// formats are the builtin functions that validate the format of strings. None
+// of them accept the empty string.
+var formats = map[string]any{
+	"isIP":        isIP,
+	"isIPv4":      isIPv4,
+	"isIPv6":      isIPv6,
+	"isCIDR":      isCIDR,
+	"isMAC":       isMAC,
+	"isHostname":  isHostname,
+	"isURL":       isURL,
+	"isEmail":     isEmail,
+	"isUUID":      isUUID,
+	"isBase64":    isBase64,
+	"isBase64URL": isBase64URL,
+	"isHex":       isHex,
+	"isJSON":      isJSON,
+}
+
+// isIP reports whether s is an IPv4 or IPv6 address.
+func isIP(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// isIPv4 reports whether s is an IPv4 address.
+func isIPv4(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && addr.Is4()
+}
+
+// isIPv6 reports whether s is an IPv6 address, including IPv4-mapped ones.
+func isIPv6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && addr.Is6()
+}
+
+// isCIDR reports whether s is an IP address prefix, e.g. 10.0.0.0/8.
+func isCIDR(s string) bool {
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+// isMAC reports whether s is a hardware address, e.g. 00:00:5e:00:53:01.
+func isMAC(s string) bool {
+	_, err := net.ParseMAC(s)
+	return err == nil
+}
+
+// isHostname reports whether s is a hostname as described by RFC 1123, with
+// an optional trailing dot.
+func isHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if c != '-' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isURL reports whether s is an absolute URL with a host. If any schemes are
+// given, the URL must use one of them.
+func isURL(s string, schemes ...string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	if len(schemes) == 0 {
+		return true
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmail reports whether s is an email address as described by RFC 5322,
+// without a display name or angle brackets.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
+
+// isUUID reports whether s is a UUID in its canonical textual form, e.g.
+// 123e4567-e89b-12d3-a456-426614174000, in either case.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isBase64 reports whether s is padded standard base64, as described by RFC
+// 4648.
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return s != "" && err == nil
+}
+
+// isBase64URL reports whether s is padded URL and filename safe base64, as
+// described by RFC 4648.
+func isBase64URL(s string) bool {
+	_, err := base64.URLEncoding.DecodeString(s)
+	return s != "" && err == nil
+}
+
+// isHex reports whether s is an even number of hexadecimal digits.
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return s != "" && err == nil
+}
+
+// isJSON reports whether s is a valid JSON value.
+func isJSON(s string) bool {
+	return json.Valid([]byte(s))
+}
@@ -0,0 +1,119 @@
+package refine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	testCases := []struct {
+		fn    string
+		input string
+
+		want bool
+	}{
+		{"isIP", "192.0.2.1", true},
+		{"isIP", "2001:db8::1", true},
+		{"isIP", "192.0.2.256", false},
+		{"isIP", "", false},
+		{"isIPv4", "192.0.2.1", true},
+		{"isIPv4", "::ffff:192.0.2.1", false},
+		{"isIPv6", "2001:db8::1", true},
+		{"isIPv6", "192.0.2.1", false},
+		{"isCIDR", "10.0.0.0/8", true},
+		{"isCIDR", "2001:db8::/32", true},
+		{"isCIDR", "10.0.0.0/33", false},
+		{"isCIDR", "10.0.0.0", false},
+		{"isMAC", "00:00:5e:00:53:01", true},
+		{"isMAC", "00:00:5e:00:53", false},
+		{"isHostname", "example.com", true},
+		{"isHostname", "example.com.", true},
+		{"isHostname", "a-1.example", true},
+		{"isHostname", "-a.example", false},
+		{"isHostname", "a..example", false},
+		{"isHostname", "a_b.example", false},
+		{"isHostname", "", false},
+		{"isURL", "https://example.com/path?q=1", true},
+		{"isURL", "example.com/path", false},
+		{"isURL", "/path", false},
+		{"isURL", "https://", false},
+		{"isEmail", "user@example.com", true},
+		{"isEmail", "User <user@example.com>", false},
+		{"isEmail", "user@", false},
+		{"isEmail", "user", false},
+		{"isUUID", "123e4567-e89b-12d3-a456-426614174000", true},
+		{"isUUID", "123E4567-E89B-12D3-A456-426614174000", true},
+		{"isUUID", "123e4567e89b12d3a456426614174000", false},
+		{"isUUID", "123e4567-e89b-12d3-a456-42661417400g", false},
+		{"isBase64", "aGVsbG8=", true},
+		{"isBase64", "aGVsbG8", false},
+		{"isBase64", "", false},
+		{"isBase64", "-_8=", false},
+		{"isBase64URL", "-_8=", true},
+		{"isHex", "deadBEEF", true},
+		{"isHex", "abc", false},
+		{"isHex", "xy", false},
+		{"isJSON", `{"a": [1, true, null]}`, true},
+		{"isJSON", `1`, true},
+		{"isJSON", `{"a": }`, false},
+		{"isJSON", "", false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.fn+"/"+tc.input, func(t *testing.T) {
+			var got bool
+			switch fn := formats[tc.fn].(type) {
+			case func(string) bool:
+				got = fn(tc.input)
+			case func(string, ...string) bool:
+				got = fn(tc.input)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckFormats(t *testing.T) {
+	type hostname string
+
+	type server struct {
+		Addr     string   `refine:"isIP(Addr) || isHostname(Addr)"`
+		Host     hostname `refine:"isHostname(Host)"`
+		Endpoint string   "refine:\"isURL(Endpoint, `http`, `https`)\""
+		Contact  string   "refine:\"Contact == `` || isEmail(Contact)\""
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want error
+	}{
+		{"Met", server{Addr: "192.0.2.1", Host: "example.com", Endpoint: "https://example.com"}, nil},
+		{"Contact", server{Addr: "example.com", Host: "example.com", Endpoint: "HTTP://example.com", Contact: "a@example.com"}, nil},
+		{"Scheme", server{Addr: "192.0.2.1", Host: "example.com", Endpoint: "ftp://example.com"}, ErrNotMet},
+		{"ArgumentType", struct {
+			N int `refine:"isIP(N)"`
+		}{N: 1}, ErrParse},
+		{"UUID", struct {
+			S string `refine:"isUUID(S)"`
+		}{S: "123e4567-e89b-12d3-a456-426614174000"}, nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	if err := RegisterFunc("isIP", func(string) bool { return true }); err == nil {
+		t.Fatal("registered a function named isIP")
+	}
+}
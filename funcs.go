@@ -0,0 +1,301 @@
+package refine
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"unicode"
+)
+
+// funcs is a set of Go functions that can be called from refinements.
+type funcs struct {
+	mu sync.RWMutex
+	m  map[string]reflect.Value
+}
+
+func (f *funcs) register(name string, fn any) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("refine.RegisterFunc: %q is not a valid name", name)
+	}
+	if keywords[name] {
+		return fmt.Errorf("refine.RegisterFunc: %s is a keyword", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("refine.RegisterFunc: %s is a builtin function", name)
+	}
+	if _, ok := quantifiers[name]; ok {
+		return fmt.Errorf("refine.RegisterFunc: %s is a builtin function", name)
+	}
+	if _, ok := libraryFuncs.lookup(name); ok {
+		return fmt.Errorf("refine.RegisterFunc: %s is a builtin function", name)
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("refine.RegisterFunc: %s: %T is not a function", name, fn)
+	}
+	if err := checkSignature(v.Type(), 0); err != nil {
+		return fmt.Errorf("refine.RegisterFunc: %s: %w", name, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.m[name]; ok {
+		return fmt.Errorf("refine.RegisterFunc: %s is already registered", name)
+	}
+	if f.m == nil {
+		f.m = map[string]reflect.Value{}
+	}
+	f.m[name] = v
+	return nil
+}
+
+func (f *funcs) lookup(name string) (reflect.Value, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	fn, ok := f.m[name]
+	return fn, ok
+}
+
+// isIdentifier reports whether name can be used to call a function, that is
+// whether it is lexed as a symbol.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// keywords are the names that are lexed as symbols but parsed as something
+// other than a name that can be called.
+var keywords = map[string]bool{
+	"true":  true,
+	"false": true,
+	"nil":   true,
+	"is":    true,
+}
+
+var globalFuncs funcs
+
+// libraryFuncs are the builtin functions written in Go, which are called in
+// the same way as registered ones.
+var libraryFuncs funcs
+
+func init() {
+	for _, pack := range []map[string]any{formats, checksums} {
+		for name, fn := range pack {
+			if err := libraryFuncs.register(name, fn); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// RegisterFunc makes fn callable by name from the refinements checked by every
+// Checker. Its parameters must be booleans, numbers or strings, and it must
+// return a single value, optionally followed by an error. A non-nil error
+// makes the refinement fail to evaluate. Nothing stops fn having side effects,
+// and it is called each time a refinement using it is evaluated.
+func RegisterFunc(name string, fn any) error {
+	return globalFuncs.register(name, fn)
+}
+
+// RegisterFunc makes fn callable by name from the refinements checked by c
+// only. Functions registered with c take precedence over those registered
+// with the package-level RegisterFunc.
+func (c *Checker) RegisterFunc(name string, fn any) error {
+	return c.funcs.register(name, fn)
+}
+
+// lookupFunc finds a function registered with c or with the package, or a
+// builtin one.
+func (c *Checker) lookupFunc(name string) (reflect.Value, bool) {
+	if fn, ok := c.funcs.lookup(name); ok {
+		return fn, true
+	}
+	if fn, ok := globalFuncs.lookup(name); ok {
+		return fn, true
+	}
+	return libraryFuncs.lookup(name)
+}
+
+// funcChecker checks the calls made by a refinement before it is evaluated.
+// Calls to registered functions are checked against their signatures, using
+// the types of the arguments that are known without evaluating them, so that
+// mistakes are reported even in calls that would not be evaluated.
+type funcChecker struct {
+	symbols map[string]box
+	lookup  func(string) (reflect.Value, bool)
+	// bound holds the names bound by quantifiers being checked.
+	bound map[string]int
+	err   error
+}
+
+// checkCalls checks the calls made by expr, returning a ParseError for the
+// first that is wrong. See funcChecker.
+func checkCalls(expr expression, symbols map[string]box, lookup func(string) (reflect.Value, bool)) error {
+	fc := &funcChecker{symbols: symbols, lookup: lookup, bound: map[string]int{}}
+	expr.Accept(fc)
+	return fc.err
+}
+
+func (fc *funcChecker) check(exprs ...expression) {
+	for _, expr := range exprs {
+		if fc.err != nil {
+			return
+		}
+		expr.Accept(fc)
+	}
+}
+
+func (fc *funcChecker) VisitBooleanExpression(*booleanExpression) {}
+func (fc *funcChecker) VisitIntegerExpression(*integerExpression) {}
+func (fc *funcChecker) VisitStringExpression(*stringExpression)   {}
+func (fc *funcChecker) VisitSymbolExpression(*symbolExpression)   {}
+
+func (fc *funcChecker) VisitListExpression(le *listExpression) {
+	fc.check(le.elems...)
+}
+
+func (fc *funcChecker) VisitSelectorExpression(se *selectorExpression) {
+	fc.check(se.expr)
+}
+
+func (fc *funcChecker) VisitIndexExpression(ie *indexExpression) {
+	fc.check(ie.expr, ie.index)
+}
+
+func (fc *funcChecker) VisitIsExpression(ie *isExpression) {
+	fc.check(ie.expr)
+}
+
+func (fc *funcChecker) VisitUnaryExpression(ue *unaryExpression) {
+	fc.check(ue.expr)
+}
+
+func (fc *funcChecker) VisitBinaryExpression(be *binaryExpression) {
+	fc.check(be.left, be.right)
+}
+
+func (fc *funcChecker) VisitCallExpression(ce *callExpression) {
+	sym, ok := ce.fn.(*symbolExpression)
+	if !ok {
+		// Method calls are checked when they are evaluated, once the type of
+		// their receiver is known.
+		fc.check(ce.fn)
+		fc.check(ce.args...)
+		return
+	}
+
+	if _, ok := quantifiers[sym.text]; ok {
+		fc.visitQuantifier(ce.args)
+		return
+	}
+
+	fc.check(ce.args...)
+	if fc.err != nil {
+		return
+	}
+
+	if _, ok := builtins[sym.text]; ok {
+		return
+	}
+	fn, ok := fc.lookup(sym.text)
+	if !ok {
+		fc.err = &ParseError{Pos: ce.Pos(), Msg: "couldn't find function " + sym.text}
+		return
+	}
+	args, known := fc.staticArgs(ce.args)
+	if err := checkArgs(sym.text, fn.Type(), args, known); err != nil {
+		fc.err = &ParseError{Pos: ce.Pos(), Msg: err.Error()}
+	}
+}
+
+// visitQuantifier checks the arguments of all or any. The name they bind
+// hides any field of the same name within the predicate.
+func (fc *funcChecker) visitQuantifier(args []expression) {
+	if len(args) != 3 {
+		// Reported when the quantifier is evaluated.
+		fc.check(args...)
+		return
+	}
+	bind, ok := args[1].(*symbolExpression)
+	if !ok {
+		fc.check(args...)
+		return
+	}
+
+	fc.check(args[0])
+	fc.bound[bind.text]++
+	fc.check(args[2])
+	fc.bound[bind.text]--
+}
+
+// staticArgs returns boxes for the arguments whose types are known before
+// evaluation, and which of them those are.
+func (fc *funcChecker) staticArgs(exprs []expression) ([]box, []bool) {
+	args := make([]box, len(exprs))
+	known := make([]bool, len(exprs))
+	for i, expr := range exprs {
+		known[i] = true
+		switch expr := expr.(type) {
+		case *booleanExpression:
+			args[i] = box{kind: boxBool, val: expr.value}
+		case *integerExpression:
+			args[i] = box{kind: boxUntypedIntConstant, val: expr.value}
+		case *stringExpression:
+			args[i] = box{kind: boxString, val: expr.text}
+		case *listExpression:
+			args[i] = box{kind: boxList}
+		case *unaryExpression:
+			ie, ok := expr.expr.(*integerExpression)
+			known[i] = ok && expr.op == unaryMinus
+			if known[i] {
+				args[i] = box{kind: boxUntypedIntConstant, val: -ie.value}
+			}
+		case *symbolExpression:
+			b, ok := fc.symbols[expr.text]
+			known[i] = ok && fc.bound[expr.text] == 0 && !b.dynamic
+			args[i] = b
+		default:
+			known[i] = false
+		}
+	}
+	return args, known
+}
+
+// checkArgs checks the number and types of args against the signature of fn,
+// skipping the arguments that aren't known.
+func checkArgs(name string, fn reflect.Type, args []box, known []bool) error {
+	n := fn.NumIn()
+	if fn.IsVariadic() {
+		if len(args) < n-1 {
+			return fmt.Errorf("%s expects at least %d arguments, got %d", name, n-1, len(args))
+		}
+	} else if len(args) != n {
+		return fmt.Errorf("%s expects %d arguments, got %d", name, n, len(args))
+	}
+
+	for i, arg := range args {
+		if !known[i] {
+			continue
+		}
+		if _, err := convertArg(arg, paramType(fn, i)); err != nil {
+			return fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// paramType returns the type of the i'th argument passed to fn.
+func paramType(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+	return fn.In(i)
+}
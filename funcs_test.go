@@ -0,0 +1,158 @@
+package refine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errTenant = errors.New("unknown tenant")
+
+func init() {
+	err := RegisterFunc("isTenantID", func(s string) bool {
+		return strings.HasPrefix(s, "t-")
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	testCases := []struct {
+		name string
+		fn   any
+
+		wantErr bool
+	}{
+		{"Bool", func(int) bool { return true }, false},
+		{"Variadic", func(...string) bool { return true }, false},
+		{"ErrorResult", func(uint8) (bool, error) { return true, nil }, false},
+		{"NotFunc", 1, true},
+		{"NilFunc", (func() bool)(nil), true},
+		{"SliceParameter", func([]int) bool { return true }, true},
+		{"NoResult", func(int) {}, true},
+		{"SecondResultNotError", func(int) (bool, bool) { return true, true }, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewChecker().RegisterFunc("fn", tc.fn)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got err %v, want err %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("Names", func(t *testing.T) {
+		c := NewChecker()
+		for _, name := range []string{"", "1fn", "is-fn", "is_fn", "len", "all", "true", "false", "nil", "is"} {
+			if c.RegisterFunc(name, func() bool { return true }) == nil {
+				t.Fatalf("registered %q", name)
+			}
+		}
+		if err := c.RegisterFunc("fn1", func() bool { return true }); err != nil {
+			t.Fatal(err)
+		}
+		if c.RegisterFunc("fn1", func() bool { return true }) == nil {
+			t.Fatal("registered fn1 twice")
+		}
+	})
+}
+
+func TestCheckFuncs(t *testing.T) {
+	c := NewChecker()
+	register := func(name string, fn any) {
+		if err := c.RegisterFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	register("inRange", func(n, lo, hi int) bool { return n >= lo && n <= hi })
+	register("oneOf", func(s string, opts ...string) bool {
+		for _, opt := range opts {
+			if s == opt {
+				return true
+			}
+		}
+		return false
+	})
+	register("knownTenant", func(s string) (bool, error) {
+		if s == "t-unknown" {
+			return false, errTenant
+		}
+		return true, nil
+	})
+	register("small", func(n int8) bool { return n < 100 })
+	// Shadows the function registered with the package.
+	register("isTenantID", func(s string) bool { return s == "t-local" })
+
+	type tenant struct {
+		Tenant string `refine:"isTenantID(Tenant)"`
+	}
+
+	testCases := []struct {
+		name    string
+		checker *Checker
+		value   any
+
+		want error
+	}{
+		{"Global", defaultChecker, tenant{Tenant: "t-1"}, nil},
+		{"GlobalNotMet", defaultChecker, tenant{Tenant: "1"}, ErrNotMet},
+		{"Shadowed", c, tenant{Tenant: "t-local"}, nil},
+		{"ShadowedNotMet", c, tenant{Tenant: "t-1"}, ErrNotMet},
+		{"Scoped", c, struct {
+			N int `refine:"inRange(N, -1, 10)"`
+		}{N: 5}, nil},
+		{"NarrowArgument", c, struct {
+			N int8 `refine:"small(N) && small(N + 1) && small(-N)"`
+		}{N: 5}, nil},
+		{"NotRegistered", defaultChecker, struct {
+			N int `refine:"inRange(N, 0, 10)"`
+		}{N: 5}, ErrParse},
+		{"Variadic", c, struct {
+			S string "refine:\"oneOf(S, `a`, `b`)\""
+		}{S: "b"}, nil},
+		{"VariadicEmpty", c, struct {
+			S string `refine:"!oneOf(S)"`
+		}{S: "b"}, nil},
+		{"ErrorResult", c, struct {
+			T string `refine:"knownTenant(T)"`
+		}{T: "t-1"}, nil},
+		{"Error", c, struct {
+			T string `refine:"knownTenant(T)"`
+		}{T: "t-unknown"}, errTenant},
+		{"ErrorIsEval", c, struct {
+			T string `refine:"knownTenant(T)"`
+		}{T: "t-unknown"}, ErrEval},
+		{"TooFewArguments", c, struct {
+			N int `refine:"inRange(N, 0)"`
+		}{N: 5}, ErrParse},
+		{"ArgumentType", c, struct {
+			N int "refine:\"inRange(N, 0, `10`)\""
+		}{N: 5}, ErrParse},
+		{"FieldType", c, struct {
+			N uint `refine:"inRange(N, 0, 10)"`
+		}{N: 5}, ErrParse},
+		{"NotEvaluated", c, struct {
+			N int `refine:"N > 0 || inRange(N, true, 10)"`
+		}{N: 5}, ErrParse},
+		{"QuantifierBinding", c, struct {
+			S  string   `refine:"true"`
+			Xs []string "refine:\"all(Xs, S, oneOf(S, `a`))\""
+		}{S: "", Xs: []string{"a"}}, nil},
+		{"QuantifierElements", c, struct {
+			Xs []int `refine:"all(Xs, x, inRange(x, 0, 1))"`
+		}{Xs: []int{0, 2}}, ErrNotMet},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.checker.Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
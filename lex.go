@@ -17,6 +17,8 @@ const (
 	tokenComma
 	tokenLeftParen
 	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
 	// Operators
 	tokenLogicalOr
 	tokenLogicalAnd
@@ -31,6 +33,7 @@ const (
 	tokenPlus
 	tokenAsterisk
 	tokenDivide
+	tokenModulo
 	tokenBitwiseOr
 	tokenBitwiseAnd
 	tokenLeftShift
@@ -41,31 +44,88 @@ const (
 	tokenSymbol
 )
 
+// tokenNames describe the kinds of token in errors.
+var tokenNames = map[tokenKind]string{
+	tokenEOF:                "end of refinement",
+	tokenPeriod:             "'.'",
+	tokenComma:              "','",
+	tokenLeftParen:          "'('",
+	tokenRightParen:         "')'",
+	tokenLeftBracket:        "'['",
+	tokenRightBracket:       "']'",
+	tokenLogicalOr:          "'||'",
+	tokenLogicalAnd:         "'&&'",
+	tokenEqual:              "'=='",
+	tokenLessThan:           "'<'",
+	tokenLessThanOrEqual:    "'<='",
+	tokenGreaterThan:        "'>'",
+	tokenGreaterThanOrEqual: "'>='",
+	tokenLogicalNot:         "'!'",
+	tokenNotEqual:           "'!='",
+	tokenMinus:              "'-'",
+	tokenPlus:               "'+'",
+	tokenAsterisk:           "'*'",
+	tokenDivide:             "'/'",
+	tokenModulo:             "'%'",
+	tokenBitwiseOr:          "'|'",
+	tokenBitwiseAnd:         "'&'",
+	tokenLeftShift:          "'<<'",
+	tokenRightShift:         "'>>'",
+	tokenInteger:            "integer",
+	tokenString:             "string",
+	tokenSymbol:             "identifier",
+}
+
+// describe describes a token in errors, with its text if its kind doesn't
+// imply it.
+func (t token) describe() string {
+	switch t.kind {
+	case tokenInteger, tokenString, tokenSymbol:
+		return tokenNames[t.kind] + " " + t.text
+	}
+	return tokenNames[t.kind]
+}
+
 const eof = 0
 const whitespace = " \t\r\v\n"
-const delimiters = string(rune(eof)) + whitespace + "()=<>+-*/"
+const delimiters = string(rune(eof)) + whitespace + "()[]=<>+-*/%"
 
 type token struct {
 	kind tokenKind
 	text string
+	pos  int // Byte offset of the token in the input.
 }
 
 type lexer struct {
-	name  string // Name of the lexer to identify it when errors occur.
 	input string // String being lexed.
 
 	start int // Start position of the current token.
 	index int // Current index in the input.
 	width int // Width of the last read rune.
 
-	tokens chan token // Channel scanned tokens are output to.
+	state   stateFunc // State to run to scan the next token.
+	tok     token     // Token last emitted by a state.
+	emitted bool      // Whether tok has been emitted and not yet returned.
 }
 
 type stateFunc func(l *lexer) stateFunc
 
-// next checks if the next rune is part of the valid set provided, but does not
-// consume it.
-func (l *lexer) next(valid string) bool {
+// next scans and returns the next token. Once the input is exhausted, or an
+// error token has been returned, it returns an end of input token.
+func (l *lexer) next() token {
+	for !l.emitted {
+		if l.state == nil {
+			return token{kind: tokenEOF, pos: len(l.input)}
+		}
+		l.state = l.state(l)
+	}
+	l.emitted = false
+	return l.tok
+}
+
+// nextIs checks if the next rune is part of the valid set provided, but does
+// not consume it.
+func (l *lexer) nextIs(valid string) bool {
 	if strings.ContainsRune(valid, l.get()) {
 		l.unget()
 		return true
@@ -122,16 +182,16 @@ func (l *lexer) peek() rune {
 	return r
 }
 
-// errorf sends an error token with a formatted error message to the tokens
-// channel, and returns nil to end the state machine.
+// errorf emits an error token with a formatted error message, and returns nil
+// to end the state machine.
 func (l *lexer) errorf(format string, args ...any) stateFunc {
-	return func(l *lexer) stateFunc {
-		l.tokens <- token{
-			kind: tokenError,
-			text: fmt.Sprintf(format, args...),
-		}
-		return nil
+	l.tok = token{
+		kind: tokenError,
+		text: fmt.Sprintf(format, args...),
+		pos:  l.start,
 	}
+	l.emitted = true
+	return nil
 }
 
 func lexExclamation(l *lexer) stateFunc {
@@ -244,11 +304,13 @@ func lexNumber(l *lexer) stateFunc {
 }
 
 func lexSymbol(l *lexer) stateFunc {
+	// References such as $root start with a '$'.
+	ref := l.accept("$")
 	for r := l.get(); unicode.IsLetter(r) || unicode.IsDigit(r); r = l.get() {
 		// intentionally empty.
 	}
 	l.unget()
-	if l.index != l.start {
+	if l.index != l.start && !(ref && l.index == l.start+1) {
 		l.emit(tokenSymbol)
 		return lexStart
 	} else {
@@ -303,55 +365,67 @@ func lexStart(l *lexer) stateFunc {
 		l.ignore()
 
 		switch {
-		case l.next("."):
+		case l.nextIs("."):
 			l.accept(".")
 			l.emit(tokenPeriod)
 			return lexStart
-		case l.next(","):
+		case l.nextIs(","):
 			l.accept(",")
 			l.emit(tokenComma)
 			return lexStart
-		case l.next("("):
+		case l.nextIs("("):
 			l.accept("(")
 			l.emit(tokenLeftParen)
 			return lexStart
-		case l.next(")"):
+		case l.nextIs(")"):
 			l.accept(")")
 			l.emit(tokenRightParen)
 			return lexStart
-		case l.next("!"):
+		case l.nextIs("["):
+			l.accept("[")
+			l.emit(tokenLeftBracket)
+			return lexStart
+		case l.nextIs("]"):
+			l.accept("]")
+			l.emit(tokenRightBracket)
+			return lexStart
+		case l.nextIs("!"):
 			return lexExclamation
-		case l.next("="):
+		case l.nextIs("="):
 			return lexEqual
-		case l.next("<"):
+		case l.nextIs("<"):
 			return lexLessThan
-		case l.next(">"):
+		case l.nextIs(">"):
 			return lexGreaterThan
-		case l.next("&"):
+		case l.nextIs("&"):
 			return lexAmpersand
-		case l.next("|"):
+		case l.nextIs("|"):
 			return lexPipe
-		case l.next("*"):
+		case l.nextIs("*"):
 			l.accept("*")
 			l.emit(tokenAsterisk)
 			return lexStart
-		case l.next("/"):
+		case l.nextIs("/"):
 			l.accept("/")
 			l.emit(tokenDivide)
 			return lexStart
-		case l.next("+"):
+		case l.nextIs("%"):
+			l.accept("%")
+			l.emit(tokenModulo)
+			return lexStart
+		case l.nextIs("+"):
 			l.accept("+")
 			l.emit(tokenPlus)
 			return lexStart
-		case l.next("-"):
+		case l.nextIs("-"):
 			l.accept("-")
 			l.emit(tokenMinus)
 			return lexStart
-		case l.next("`"):
+		case l.nextIs("`"):
 			return lexString
-		case l.next("0123456789"):
+		case l.nextIs("0123456789"):
 			return lexNumber
-		case unicode.IsLetter(l.peek()):
+		case unicode.IsLetter(l.peek()), l.nextIs("$"):
 			return lexSymbol
 		}
 
@@ -364,35 +438,26 @@ func lexStart(l *lexer) stateFunc {
 	}
 }
 
-func (l *lexer) run() {
-	for state := lexStart; state != nil; {
-		state = state(l)
-	}
-	close(l.tokens)
-}
-
 func (l *lexer) text() string {
 	return l.input[l.start:l.index]
 }
 
+// emit makes the runes read so far the token returned by next.
 func (l *lexer) emit(k tokenKind) {
-	tok := token{
+	l.tok = token{
 		kind: k,
 		text: l.text(),
+		pos:  l.start,
 	}
-	l.tokens <- tok
+	l.emitted = true
 	l.start = l.index
 }
 
-// lex splits the input string into tokens and outputs them to the channel it returns.
-func lex(name string, expr string) chan token {
-	var l = lexer{
-		name:   name,
-		input:  expr,
-		start:  0,
-		index:  0,
-		tokens: make(chan token),
+// lex returns a lexer that splits the input string into tokens as they are
+// read with its next method.
+func lex(expr string) *lexer {
+	return &lexer{
+		input: expr,
+		state: lexStart,
 	}
-	go l.run()
-	return l.tokens
 }
@@ -1,8 +1,10 @@
 package refine
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -12,32 +14,36 @@ func TestLexer(t *testing.T) {
 		want      []token
 	}{
 		// Basic cases
-		{"0", []token{{tokenInteger, "0"}}},
-		{"1_000_000", []token{{tokenInteger, "1_000_000"}}},
-		{"`string`", []token{{tokenString, "`string`"}}},
-		{"symbol", []token{{tokenSymbol, "symbol"}}},
-		{". , ()", []token{{tokenPeriod, "."}, {tokenComma, ","}, {tokenLeftParen, "("}, {tokenRightParen, ")"}}},
-		{"== != <= >= < >", []token{{tokenEqual, "=="}, {tokenNotEqual, "!="}, {tokenLessThanOrEqual, "<="}, {tokenGreaterThanOrEqual, ">="}, {tokenLessThan, "<"}, {tokenGreaterThan, ">"}}},
-		{"! | & || &&", []token{{tokenLogicalNot, "!"}, {tokenBitwiseOr, "|"}, {tokenBitwiseAnd, "&"}, {tokenLogicalOr, "||"}, {tokenLogicalAnd, "&&"}}},
-		{"* / + - << >>", []token{{tokenAsterisk, "*"}, {tokenDivide, "/"}, {tokenPlus, "+"}, {tokenMinus, "-"}, {tokenLeftShift, "<<"}, {tokenRightShift, ">>"}}},
+		{"0", []token{{tokenInteger, "0", 0}}},
+		{"1_000_000", []token{{tokenInteger, "1_000_000", 0}}},
+		{"`string`", []token{{tokenString, "`string`", 0}}},
+		{"symbol", []token{{tokenSymbol, "symbol", 0}}},
+		{"$root", []token{{tokenSymbol, "$root", 0}}},
+		{". , ()", []token{{tokenPeriod, ".", 0}, {tokenComma, ",", 2}, {tokenLeftParen, "(", 4}, {tokenRightParen, ")", 5}}},
+		{"== != <= >= < >", []token{{tokenEqual, "==", 0}, {tokenNotEqual, "!=", 3}, {tokenLessThanOrEqual, "<=", 6}, {tokenGreaterThanOrEqual, ">=", 9}, {tokenLessThan, "<", 12}, {tokenGreaterThan, ">", 14}}},
+		{"! | & || &&", []token{{tokenLogicalNot, "!", 0}, {tokenBitwiseOr, "|", 2}, {tokenBitwiseAnd, "&", 4}, {tokenLogicalOr, "||", 6}, {tokenLogicalAnd, "&&", 9}}},
+		{"* / % + - << >>", []token{{tokenAsterisk, "*", 0}, {tokenDivide, "/", 2}, {tokenModulo, "%", 4}, {tokenPlus, "+", 6}, {tokenMinus, "-", 8}, {tokenLeftShift, "<<", 10}, {tokenRightShift, ">>", 13}}},
 
 		// Complex cases
-		{"-1", []token{{tokenMinus, "-"}, {tokenInteger, "1"}}},
-		{"foo > bar", []token{{tokenSymbol, "foo"}, {tokenGreaterThan, ">"}, {tokenSymbol, "bar"}}},
-		{"0`hello`symbol", []token{{tokenInteger, "0"}, {tokenString, "`hello`"}, {tokenSymbol, "symbol"}}},
-		{"-+-+400_000", []token{{tokenMinus, "-"}, {tokenPlus, "+"}, {tokenMinus, "-"}, {tokenPlus, "+"}, {tokenInteger, "400_000"}}},
-		{"5 * (-1>>2)", []token{{tokenInteger, "5"}, {tokenAsterisk, "*"}, {tokenLeftParen, "("}, {tokenMinus, "-"}, {tokenInteger, "1"}, {tokenRightShift, ">>"}, {tokenInteger, "2"}}},
+		{"-1", []token{{tokenMinus, "-", 0}, {tokenInteger, "1", 1}}},
+		{"foo > bar", []token{{tokenSymbol, "foo", 0}, {tokenGreaterThan, ">", 4}, {tokenSymbol, "bar", 6}}},
+		{"0`hello`symbol", []token{{tokenInteger, "0", 0}, {tokenString, "`hello`", 1}, {tokenSymbol, "symbol", 8}}},
+		{"-+-+400_000", []token{{tokenMinus, "-", 0}, {tokenPlus, "+", 1}, {tokenMinus, "-", 2}, {tokenPlus, "+", 3}, {tokenInteger, "400_000", 4}}},
+		{"  x ", []token{{tokenSymbol, "x", 2}, {tokenEOF, "", 4}}},
+		{"5 * (-1>>2)", []token{{tokenInteger, "5", 0}, {tokenAsterisk, "*", 2}, {tokenLeftParen, "(", 4}, {tokenMinus, "-", 5}, {tokenInteger, "1", 6}, {tokenRightShift, ">>", 7}, {tokenInteger, "2", 9}}},
 
 		// Negative cases
-		{`"string"`, []token{{tokenError, `unexpected rune '"'`}}},
+		{`"string"`, []token{{tokenError, `unexpected rune '"'`, 0}}},
+		{"$ root", []token{{tokenError, "invalid symbol", 0}}},
+		{"a == `b", []token{{tokenSymbol, "a", 0}, {tokenEqual, "==", 2}, {tokenError, "reached EOF when reading string", 5}}},
 	}
 
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.predicate, func(t *testing.T) {
-			tokens := lex(tc.predicate, tc.predicate)
+			tokens := lex(tc.predicate)
 			for _, want := range tc.want {
-				got := <-tokens
+				got := tokens.next()
 				if !reflect.DeepEqual(got, want) {
 					t.Fatalf("failed to lex %q: got token %v, want token %v", tc.predicate, got, want)
 				}
@@ -59,10 +65,10 @@ func FuzzLexerIntegers(f *testing.F) {
 
 	f.Fuzz(func(t *testing.T, i int) {
 		predicate := fmt.Sprintf("%d", i)
-		tokens := lex(predicate, predicate)
+		tokens := lex(predicate)
 		if i >= 0 {
 			// Verify that a number is produced
-			tok := <-tokens
+			tok := tokens.next()
 			if tok.kind != tokenInteger {
 				t.Fatalf("got token %+#v, wanted an integer token", tok)
 			}
@@ -71,14 +77,14 @@ func FuzzLexerIntegers(f *testing.F) {
 			}
 		} else {
 			// Verify that a minus sign is produced for negative numbers
-			tok := <-tokens
+			tok := tokens.next()
 			if tok.kind != tokenMinus {
 				t.Fatalf("got token %+#v, wanted an minus token", tok)
 			}
 			if got, want := tok.text, "-"; got != want {
 				t.Fatalf("got token text %s, want %s", got, want)
 			}
-			tok = <-tokens
+			tok = tokens.next()
 			if tok.kind != tokenInteger {
 				t.Fatalf("got token %+#v, wanted an integer token", tok)
 			}
@@ -86,9 +92,55 @@ func FuzzLexerIntegers(f *testing.F) {
 				t.Fatalf("got token text %s, want %s", got, want)
 			}
 		}
-		tok := <-tokens
+		tok := tokens.next()
 		if tok.kind != tokenEOF {
 			t.Fatalf("got token %+#v, wanted EOF token", tok)
 		}
 	})
 }
+
+func TestLexerEnd(t *testing.T) {
+	for _, predicate := range []string{"a", "a `b"} {
+		l := lex(predicate)
+		for tok := l.next(); tok.kind != tokenEOF; tok = l.next() {
+			if tok.kind == tokenError {
+				break
+			}
+		}
+		// Reading past the end keeps returning the end of the input.
+		for i := 0; i < 2; i++ {
+			if tok := l.next(); tok.kind != tokenEOF || tok.pos != len(predicate) {
+				t.Fatalf("got token %+v past the end of %q, want EOF", tok, predicate)
+			}
+		}
+	}
+}
+
+func TestLexerLeak(t *testing.T) {
+	type malformed struct {
+		A int `refine:"A >"`
+		B int "refine:\"B == `b\""
+		C int `refine:"C ) && C >"`
+		D int `refine:"D > 0 D"`
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if err := CheckAll(malformed{}); !errors.Is(err, ErrParse) {
+			t.Fatalf("got %v, want %v", err, ErrParse)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("got %d goroutines after checking malformed refinements, want %d", after, before)
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	predicate := "Quantity > 0 && Price <= $root.MaxPrice || isEmail(Contact) && len(Tags[0]) < 16"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := lex(predicate)
+		for tok := l.next(); tok.kind != tokenEOF; tok = l.next() {
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package refine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Tags giving the message and code of the error returned when the refinement
+// of a field is not met.
+const (
+	msgTag  = "refinemsg"
+	codeTag = "refinecode"
+)
+
+// customize sets the message and code of err from the tags of field, if err
+// is an error for a refinement that wasn't met.
+func customize(err error, ev *evaluator, field reflect.StructField) error {
+	fe, ok := err.(*FieldError)
+	if !ok || fe.Kind != KindNotMet {
+		return err
+	}
+	fe.code = field.Tag.Get(codeTag)
+	if msg, ok := field.Tag.Lookup(msgTag); ok {
+		fe.message = interpolate(ev, msg)
+	}
+	return fe
+}
+
+// interpolate replaces the expressions in braces in a message by their
+// values, e.g. "must be at most {Max}". Expressions that can't be evaluated
+// are left as they are, and "{{" and "}}" are replaced by "{" and "}".
+func interpolate(ev *evaluator, msg string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexAny(msg, "{}")
+		if i < 0 {
+			break
+		}
+		b.WriteString(msg[:i])
+		msg = msg[i:]
+
+		if strings.HasPrefix(msg, "{{") || strings.HasPrefix(msg, "}}") {
+			b.WriteByte(msg[0])
+			msg = msg[2:]
+			continue
+		}
+		if msg[0] == '}' {
+			b.WriteByte('}')
+			msg = msg[1:]
+			continue
+		}
+		j := strings.IndexByte(msg, '}')
+		if j < 0 {
+			break
+		}
+
+		if val, ok := evalPlaceholder(ev, msg[1:j]); ok {
+			b.WriteString(val)
+		} else {
+			b.WriteString(msg[:j+1])
+		}
+		msg = msg[j+1:]
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+func evalPlaceholder(ev *evaluator, expr string) (string, bool) {
+	parsed, err := parse(lex(expr))
+	if err != nil {
+		return "", false
+	}
+	parsed.Accept(ev)
+	if ev.Err != nil {
+		return "", false
+	}
+	return fmt.Sprint(ev.Result.original()), true
+}
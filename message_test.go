@@ -0,0 +1,67 @@
+package refine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckMessages(t *testing.T) {
+	type item struct {
+		Min  int      `refine:"Min >= 0" refinemsg:"must not be negative" refinecode:"E_MIN"`
+		Max  int      `refine:"Max >= Min" refinemsg:"must be at least {Min}, not {Max}" refinecode:"E_RANGE"`
+		Name string   "refine:\"Name != ``\" refinemsg:\"{{Name}} of {$root.Max + 1} is {Unknown}\""
+		Tags []string `refine:"required" refinemsg:"{len(Tags)} tags" refinecode:"E_REQUIRED"`
+		Note string   "refine:\"Note == `` || Note + 1 == 2\" refinemsg:\"never used\" refinecode:\"E_NOTE\""
+		_    struct{} `refine:"Max - Min < 10" refinemsg:"range of {Max - Min} is too wide" refinecode:"E_WIDE"`
+	}
+
+	valid := func() item {
+		return item{Min: 1, Max: 2, Name: "a", Tags: []string{}, Note: ""}
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(i *item)
+
+		want        error
+		wantCode    string
+		wantMessage string
+	}{
+		{"Min", func(i *item) { i.Min = -1 }, ErrNotMet, "E_MIN", "must not be negative"},
+		{"Interpolated", func(i *item) { i.Max = 0 }, ErrNotMet, "E_RANGE", "must be at least 1, not 0"},
+		{"Escaped", func(i *item) { i.Name = "" }, ErrNotMet, "", "{Name} of 3 is {Unknown}"},
+		{"Required", func(i *item) { i.Tags = nil }, ErrRequired, "E_REQUIRED", "0 tags"},
+		{"Struct", func(i *item) { i.Max = 20 }, ErrNotMet, "E_WIDE", "range of 19 is too wide"},
+		{"NotForEvalErrors", func(i *item) { i.Note = "x" }, ErrEval, "", ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			v := valid()
+			tc.modify(&v)
+			got := Check(v)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+
+			var coded interface {
+				Code() string
+				Message() string
+			}
+			if !errors.As(got, &coded) {
+				t.Fatalf("got %v; want an error with a code and message", got)
+			}
+			if code := coded.Code(); code != tc.wantCode {
+				t.Fatalf("got code %q; want %q", code, tc.wantCode)
+			}
+			wantMessage := tc.wantMessage
+			if wantMessage == "" {
+				wantMessage = got.Error()
+			}
+			if msg := coded.Message(); msg != wantMessage {
+				t.Fatalf("got message %q; want %q", msg, wantMessage)
+			}
+		})
+	}
+}
@@ -4,8 +4,7 @@
 package refine
 
 import (
-	"errors"
-	"fmt"
+	"sort"
 	"strconv"
 )
 
@@ -16,7 +15,11 @@ type visitor interface {
 	VisitIntegerExpression(i *integerExpression)
 	VisitStringExpression(s *stringExpression)
 	VisitSymbolExpression(s *symbolExpression)
+	VisitListExpression(l *listExpression)
 	VisitSelectorExpression(s *selectorExpression)
+	VisitCallExpression(c *callExpression)
+	VisitIndexExpression(i *indexExpression)
+	VisitIsExpression(i *isExpression)
 	VisitUnaryExpression(u *unaryExpression)
 	VisitBinaryExpression(b *binaryExpression)
 }
@@ -25,6 +28,16 @@ type expression interface {
 	// Accept calls the appropriate method of a visitor for a given
 	// implementation of expression.
 	Accept(v visitor)
+	// Pos returns the byte offset of the start of the expression in the
+	// input it was parsed from.
+	Pos() int
+}
+
+// pos is embedded by expressions to record their position.
+type pos int
+
+func (p pos) Pos() int {
+	return int(p)
 }
 
 // Accepts calls a visitor on a boolean expression.
@@ -47,11 +60,31 @@ func (se *symbolExpression) Accept(v visitor) {
 	v.VisitSymbolExpression(se)
 }
 
+// Accepts calls a visitor on a list expression.
+func (le *listExpression) Accept(v visitor) {
+	v.VisitListExpression(le)
+}
+
 // Accepts calls a visitor on a selector expression.
 func (se *selectorExpression) Accept(v visitor) {
 	v.VisitSelectorExpression(se)
 }
 
+// Accepts calls a visitor on a call expression.
+func (ce *callExpression) Accept(v visitor) {
+	v.VisitCallExpression(ce)
+}
+
+// Accepts calls a visitor on an index expression.
+func (ie *indexExpression) Accept(v visitor) {
+	v.VisitIndexExpression(ie)
+}
+
+// Accepts calls a visitor on an is expression.
+func (ie *isExpression) Accept(v visitor) {
+	v.VisitIsExpression(ie)
+}
+
 // Accepts calls a visitor on a unary expression.
 func (ue *unaryExpression) Accept(v visitor) {
 	v.VisitUnaryExpression(ue)
@@ -63,28 +96,57 @@ func (be *binaryExpression) Accept(v visitor) {
 }
 
 type booleanExpression struct {
+	pos
 	text  string
 	value bool
 }
 
 type integerExpression struct {
+	pos
 	text  string
 	value int
 }
 
 type stringExpression struct {
+	pos
 	text string
 }
 
 type symbolExpression struct {
+	pos
 	text string
 }
 
+type listExpression struct {
+	pos
+	elems []expression
+}
+
 type selectorExpression struct {
-	sym       *symbolExpression
+	pos
+	expr      expression
 	selection *symbolExpression
 }
 
+type callExpression struct {
+	pos
+	fn   expression
+	args []expression
+}
+
+type indexExpression struct {
+	pos
+	expr  expression
+	index expression
+}
+
+// isExpression tests the dynamic type of a value, e.g. Value is string.
+type isExpression struct {
+	pos
+	expr expression
+	typ  string
+}
+
 type unaryOperator int
 
 const (
@@ -95,6 +157,7 @@ const (
 )
 
 type unaryExpression struct {
+	pos
 	op   unaryOperator
 	expr expression
 }
@@ -104,6 +167,7 @@ type binaryOperator int
 const (
 	binaryMultiply binaryOperator = iota
 	binaryDivide
+	binaryModulo
 
 	binaryMinus
 	binaryPlus
@@ -123,97 +187,286 @@ const (
 )
 
 type binaryExpression struct {
+	pos
 	op    binaryOperator
 	left  expression
 	right expression
 }
 
+// badExpression stands in for an expression that could not be parsed, so that
+// parsing can carry on and find any other errors. It is never visited, as
+// parse fails if it finds any errors.
+type badExpression struct {
+	pos
+}
+
+func (be *badExpression) Accept(v visitor) {}
+
 type parser struct {
 	// last is the token that was last accepted token within a parsing function.
 	last token
 	// tok is the current token looking to be accepted from a parsing function.
 	tok token
-	// tokens streams tokens from the lexer to the parser.
-	tokens chan token
+	// tokens are read from a lexer, or any other scanner, one at a time.
+	tokens scanner
+	// expected are the kinds of token that have been looked for, and not
+	// found, since the last token was accepted.
+	expected []tokenKind
+	// errs are the errors found so far, in the order of their positions.
+	errs []*ParseError
+}
+
+// scanner produces the tokens of an expression in turn, ending with an end of
+// input or error token. lexer is the scanner used outside of tests.
+type scanner interface {
+	next() token
 }
 
-// accept looks for a kind of token waiting in channel. If the token in the
-// channel matches the kind provided, it is consumed from the channel.
+// accept looks for a kind of token waiting to be read. If the token matches
+// the kind provided, it is consumed from the scanner.
 func (p *parser) accept(kind tokenKind) bool {
 	if p.tok.kind == kind {
 		p.last = p.tok
-		p.tok = <-p.tokens
+		p.tok = p.tokens.next()
+		p.expected = p.expected[:0]
 		return true
 	} else {
+		p.expected = append(p.expected, kind)
 		return false
 	}
 }
 
-func parseAtom(p *parser) (expression, error) {
-	if p.accept(tokenLeftParen) {
-		expr, err := parseExpression(p)
-		if err != nil {
-			return nil, err
+// fail records an error for the current token, which is not one of those
+// expected. Only the first error at a position is recorded, as the others
+// follow from it.
+func (p *parser) fail() {
+	pe := &ParseError{
+		Pos:      p.tok.pos,
+		Msg:      "unexpected " + p.tok.describe(),
+		Expected: expectedNames(p.expected),
+	}
+	if p.tok.kind == tokenError {
+		pe = &ParseError{Pos: p.tok.pos, Msg: p.tok.text}
+	}
+	p.report(pe)
+}
+
+// report records an error unless there is already one at its position.
+func (p *parser) report(pe *ParseError) {
+	if n := len(p.errs); n > 0 && p.errs[n-1].Pos >= pe.Pos {
+		return
+	}
+	p.errs = append(p.errs, pe)
+}
+
+// synchronize skips tokens after an error until one of the kinds given, or
+// the end of the input, so that parsing can resume there. Tokens within
+// parentheses or brackets opened while skipping are skipped as a whole.
+func (p *parser) synchronize(kinds ...tokenKind) {
+	depth := 0
+	for {
+		switch p.tok.kind {
+		case tokenEOF, tokenError:
+			return
+		case tokenLeftParen, tokenLeftBracket:
+			depth++
+		case tokenRightParen, tokenRightBracket:
+			if depth > 0 {
+				depth--
+				p.accept(p.tok.kind)
+				continue
+			}
 		}
-		if !p.accept(tokenRightParen) {
-			return nil, errors.New("expected ')'")
+		if depth == 0 {
+			for _, kind := range kinds {
+				if p.tok.kind == kind {
+					return
+				}
+			}
+		}
+		p.accept(p.tok.kind)
+	}
+}
+
+// binaryOnly are the kinds of token that can only be binary operators. When
+// a binary operator is expected, they are described together.
+var binaryOnly = map[tokenKind]bool{
+	tokenLogicalOr: true, tokenLogicalAnd: true, tokenEqual: true,
+	tokenNotEqual: true, tokenLessThan: true, tokenLessThanOrEqual: true,
+	tokenGreaterThan: true, tokenGreaterThanOrEqual: true, tokenAsterisk: true,
+	tokenDivide: true, tokenModulo: true, tokenLeftShift: true,
+	tokenRightShift: true,
+}
+
+// expectedNames describes the kinds of token expected in the order of their
+// kinds, without repeats, and with the end of the input last.
+func expectedNames(kinds []tokenKind) []string {
+	sorted := append([]tokenKind(nil), kinds...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i] == tokenEOF || sorted[j] == tokenEOF {
+			return sorted[j] == tokenEOF && sorted[i] != tokenEOF
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	// Every binary operator is tried once an operand has been parsed, and
+	// logical or is the last to be tried.
+	operators := false
+	for _, kind := range kinds {
+		operators = operators || kind == tokenLogicalOr
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, kind := range sorted {
+		name := tokenNames[kind]
+		if operators && binaryOnly[kind] {
+			name = "operator"
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseList parses a comma separated list of expressions following an opening
+// parenthesis or bracket, up to and including the closing token. After an
+// error it resumes at the next comma or the closing token.
+func parseList(p *parser, closing tokenKind) []expression {
+	var exprs []expression
+	if p.accept(closing) {
+		return exprs
+	}
+	for {
+		exprs = append(exprs, parseExpression(p))
+		if p.accept(closing) {
+			return exprs
+		}
+		if !p.accept(tokenComma) {
+			p.fail()
+			p.synchronize(tokenComma, closing)
+			if p.accept(closing) || !p.accept(tokenComma) {
+				return exprs
+			}
+		}
+	}
+}
+
+// expect accepts a token closing a parenthesis or bracket. If it is missing,
+// the tokens up to it are skipped.
+func (p *parser) expect(closing tokenKind) {
+	if !p.accept(closing) {
+		p.fail()
+		p.synchronize(closing)
+		p.accept(closing)
+	}
+}
+
+func parseAtom(p *parser) expression {
+	if p.accept(tokenLeftParen) {
+		expr := parseExpression(p)
+		p.expect(tokenRightParen)
+		return expr
+	}
+
+	if p.accept(tokenLeftBracket) {
+		start := p.last.pos
+		return &listExpression{
+			pos:   pos(start),
+			elems: parseList(p, tokenRightBracket),
 		}
-		return expr, nil
 	}
 
 	if p.accept(tokenSymbol) {
 		switch p.last.text {
 		case "true":
 			return &booleanExpression{
+				pos:   pos(p.last.pos),
 				text:  p.last.text,
 				value: true,
-			}, nil
+			}
 		case "false":
 			return &booleanExpression{
+				pos:   pos(p.last.pos),
 				text:  p.last.text,
 				value: false,
-			}, nil
+			}
 		default:
-			sym := &symbolExpression{
+			return &symbolExpression{
+				pos:  pos(p.last.pos),
 				text: p.last.text,
 			}
-			if p.accept(tokenPeriod) {
-				if p.accept(tokenSymbol) {
-					selection := &symbolExpression{
-						text: p.last.text,
-					}
-					return &selectorExpression{
-						sym:       sym,
-						selection: selection,
-					}, nil
-				}
-				return nil, errors.New("expected an identifier following selector")
-			}
-			return sym, nil
 		}
 	}
 
 	if p.accept(tokenString) {
 		return &stringExpression{
+			pos:  pos(p.last.pos),
 			text: p.last.text[1 : len(p.last.text)-1],
-		}, nil
+		}
 	}
 
 	if p.accept(tokenInteger) {
 		value, err := strconv.ParseInt(p.last.text, 0, 0)
 		if err != nil {
-			return nil, err
+			p.report(&ParseError{Pos: p.last.pos, Msg: "integer " + p.last.text + " is out of range"})
 		}
 		return &integerExpression{
+			pos:   pos(p.last.pos),
 			text:  p.last.text,
 			value: int(value),
-		}, nil
+		}
 	}
 
-	return nil, errors.New("couldn't parse expression!")
+	// The operand is missing. The token is left for the operators around it
+	// to accept, or for parse to skip.
+	p.fail()
+	return &badExpression{pos: pos(p.tok.pos)}
+}
+
+// parsePostfix parses an atom followed by any number of selectors, calls and
+// index operations, e.g. Orders[0].Total() or Version.Major().
+func parsePostfix(p *parser) expression {
+	expr := parseAtom(p)
+
+	for {
+		switch {
+		case p.accept(tokenPeriod):
+			if !p.accept(tokenSymbol) {
+				p.fail()
+				return &badExpression{pos: pos(expr.Pos())}
+			}
+			expr = &selectorExpression{
+				pos:  pos(expr.Pos()),
+				expr: expr,
+				selection: &symbolExpression{
+					pos:  pos(p.last.pos),
+					text: p.last.text,
+				},
+			}
+		case p.accept(tokenLeftParen):
+			expr = &callExpression{
+				pos:  pos(expr.Pos()),
+				fn:   expr,
+				args: parseList(p, tokenRightParen),
+			}
+		case p.accept(tokenLeftBracket):
+			index := parseExpression(p)
+			p.expect(tokenRightBracket)
+			expr = &indexExpression{
+				pos:   pos(expr.Pos()),
+				expr:  expr,
+				index: index,
+			}
+		default:
+			return expr
+		}
+	}
 }
 
-func parseUnary(p *parser) (expression, error) {
+func parseUnary(p *parser) expression {
 	var accepted = map[tokenKind]unaryOperator{
 		tokenPlus:       unaryPlus,
 		tokenMinus:      unaryMinus,
@@ -222,47 +475,43 @@ func parseUnary(p *parser) (expression, error) {
 
 	for kind, op := range accepted {
 		if p.accept(kind) {
-			expr, err := parseUnary(p)
+			start := p.last.pos
 			return &unaryExpression{
+				pos:  pos(start),
 				op:   op,
-				expr: expr,
-			}, err
+				expr: parseUnary(p),
+			}
 		}
 	}
 
-	return parseAtom(p)
+	return parsePostfix(p)
 }
 
-func parseBinaryMultiplicative(p *parser) (expression, error) {
-	left, err := parseUnary(p)
-	if err != nil {
-		return nil, err
-	}
+func parseBinaryMultiplicative(p *parser) expression {
+	left := parseUnary(p)
 
 	var accepted = map[tokenKind]binaryOperator{
 		tokenAsterisk: binaryMultiply,
 		tokenDivide:   binaryDivide,
+		tokenModulo:   binaryModulo,
 	}
 
 	for kind, op := range accepted {
 		if p.accept(kind) {
-			right, err := parseBinaryMultiplicative(p)
 			return &binaryExpression{
+				pos:   pos(left.Pos()),
 				op:    op,
 				left:  left,
-				right: right,
-			}, err
+				right: parseBinaryMultiplicative(p),
+			}
 		}
 	}
 
-	return left, nil
+	return left
 }
 
-func parseBinaryAdditive(p *parser) (expression, error) {
-	left, err := parseBinaryMultiplicative(p)
-	if err != nil {
-		return nil, err
-	}
+func parseBinaryAdditive(p *parser) expression {
+	left := parseBinaryMultiplicative(p)
 
 	var accepted = map[tokenKind]binaryOperator{
 		tokenPlus:       binaryPlus,
@@ -273,22 +522,62 @@ func parseBinaryAdditive(p *parser) (expression, error) {
 
 	for kind, op := range accepted {
 		if p.accept(kind) {
-			right, err := parseBinaryAdditive(p)
 			return &binaryExpression{
+				pos:   pos(left.Pos()),
 				op:    op,
 				left:  left,
-				right: right,
-			}, err
+				right: parseBinaryAdditive(p),
+			}
 		}
 	}
 
-	return left, nil
+	return left
 }
 
-func parseBinaryComparative(p *parser) (expression, error) {
-	left, err := parseBinaryAdditive(p)
-	if err != nil {
-		return nil, err
+// parseTypeName parses the name of a type following is, such as int, *Error,
+// []string or time.Duration.
+func parseTypeName(p *parser) string {
+	var prefix string
+	for {
+		if p.accept(tokenAsterisk) {
+			prefix += "*"
+		} else if p.accept(tokenLeftBracket) {
+			if !p.accept(tokenRightBracket) {
+				p.fail()
+				return ""
+			}
+			prefix += "[]"
+		} else {
+			break
+		}
+	}
+
+	if !p.accept(tokenSymbol) {
+		p.fail()
+		return ""
+	}
+	name := p.last.text
+	if p.accept(tokenPeriod) {
+		if !p.accept(tokenSymbol) {
+			p.fail()
+			return ""
+		}
+		name += "." + p.last.text
+	}
+
+	return prefix + name
+}
+
+func parseBinaryComparative(p *parser) expression {
+	left := parseBinaryAdditive(p)
+
+	if p.tok.kind == tokenSymbol && p.tok.text == "is" {
+		p.accept(tokenSymbol)
+		return &isExpression{
+			pos:  pos(left.Pos()),
+			expr: left,
+			typ:  parseTypeName(p),
+		}
 	}
 
 	var accepted = map[tokenKind]binaryOperator{
@@ -302,81 +591,83 @@ func parseBinaryComparative(p *parser) (expression, error) {
 
 	for kind, op := range accepted {
 		if p.accept(kind) {
-			right, err := parseBinaryComparative(p)
 			return &binaryExpression{
+				pos:   pos(left.Pos()),
 				op:    op,
 				left:  left,
-				right: right,
-			}, err
+				right: parseBinaryComparative(p),
+			}
 		}
 	}
 
-	return left, nil
+	return left
 }
 
-func parseBinaryLogicalAnd(p *parser) (expression, error) {
-	left, err := parseBinaryComparative(p)
-	if err != nil {
-		return nil, err
-	}
+func parseBinaryLogicalAnd(p *parser) expression {
+	left := parseBinaryComparative(p)
 
 	if p.accept(tokenLogicalAnd) {
-		right, err := parseBinaryLogicalAnd(p)
 		return &binaryExpression{
+			pos:   pos(left.Pos()),
 			op:    binaryLogicalAnd,
 			left:  left,
-			right: right,
-		}, err
+			right: parseBinaryLogicalAnd(p),
+		}
 	}
 
-	return left, nil
+	return left
 }
 
-func parseBinaryLogicalOr(p *parser) (expression, error) {
-	left, err := parseBinaryLogicalAnd(p)
-	if err != nil {
-		return nil, err
-	}
+func parseBinaryLogicalOr(p *parser) expression {
+	left := parseBinaryLogicalAnd(p)
 
 	if p.accept(tokenLogicalOr) {
-		right, err := parseBinaryLogicalOr(p)
 		return &binaryExpression{
+			pos:   pos(left.Pos()),
 			op:    binaryLogicalOr,
 			left:  left,
-			right: right,
-		}, err
+			right: parseBinaryLogicalOr(p),
+		}
 	}
 
-	return left, nil
+	return left
 }
 
 // parseExpression is the top-level parsing function starting at the lowest
 // precedence level, working its way up the chain of functions according to
 // precedence of operations.
-func parseExpression(p *parser) (expression, error) {
+func parseExpression(p *parser) expression {
 	return parseBinaryLogicalOr(p)
 }
 
-func parse(tokens chan token) (expression, error) {
+// parse parses the tokens of an expression. Parsing carries on after an
+// error, resuming at the next logical operator, to find any others. The error
+// returned is a ParseError, or ParseErrors if there are several.
+func parse(tokens scanner) (expression, error) {
 	p := &parser{
-		tok:    <-tokens,
+		tok:    tokens.next(),
 		tokens: tokens,
 	}
 
-	expr, err := parseExpression(p)
-	if err != nil {
-		return nil, err
+	expr := parseExpression(p)
+	for !p.accept(tokenEOF) && p.tok.kind != tokenError {
+		// The expression ends early, so skip to an operator that the rest
+		// can be parsed from.
+		p.fail()
+		p.synchronize(tokenLogicalAnd, tokenLogicalOr)
+		if p.accept(tokenLogicalAnd) || p.accept(tokenLogicalOr) {
+			parseExpression(p)
+		}
 	}
-
-	// Create a list of any unparsed tokens as an error
-	var unparsedTokens []token
-	for tok := p.tok; tok.kind != tokenEOF; tok = <-tokens {
-		unparsedTokens = append(unparsedTokens, tok)
+	if p.tok.kind == tokenError {
+		p.fail()
 	}
 
-	if len(unparsedTokens) > 0 {
-		return nil, fmt.Errorf("Unparsed tokens: %v", unparsedTokens)
+	switch len(p.errs) {
+	case 0:
+		return expr, nil
+	case 1:
+		return nil, p.errs[0]
 	}
-
-	return expr, err
+	return nil, ParseErrors(p.errs)
 }
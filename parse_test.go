@@ -6,6 +6,19 @@ import (
 	"testing"
 )
 
+// tokenList is a scanner for tokens given by a test, which are followed by the
+// end of the input.
+type tokenList []token
+
+func (l *tokenList) next() token {
+	if len(*l) == 0 {
+		return token{kind: tokenEOF}
+	}
+	tok := (*l)[0]
+	*l = (*l)[1:]
+	return tok
+}
+
 func TestParser(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -15,11 +28,42 @@ func TestParser(t *testing.T) {
 	}{
 		{
 			name:   "basic math",
-			tokens: []token{{tokenInteger, "1"}, {tokenPlus, "+"}, {tokenInteger, "2"}},
+			tokens: []token{{tokenInteger, "1", 0}, {tokenPlus, "+", 2}, {tokenInteger, "2", 4}},
 			want: &binaryExpression{
 				op:    binaryPlus,
 				left:  &integerExpression{text: "1", value: 1},
-				right: &integerExpression{text: "2", value: 2},
+				right: &integerExpression{pos: 4, text: "2", value: 2},
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "call",
+			tokens: []token{{tokenSymbol, "bigInt", 0}, {tokenLeftParen, "(", 6}, {tokenSymbol, "N", 7}, {tokenRightParen, ")", 8}, {tokenGreaterThan, ">", 10}, {tokenInteger, "0", 12}},
+			want: &binaryExpression{
+				op: binaryGreaterThan,
+				left: &callExpression{
+					fn:   &symbolExpression{text: "bigInt"},
+					args: []expression{&symbolExpression{pos: 7, text: "N"}},
+				},
+				right: &integerExpression{pos: 12, text: "0", value: 0},
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "index",
+			tokens: []token{{tokenSymbol, "Tags", 0}, {tokenLeftBracket, "[", 4}, {tokenInteger, "0", 5}, {tokenRightBracket, "]", 6}},
+			want: &indexExpression{
+				expr:  &symbolExpression{text: "Tags"},
+				index: &integerExpression{pos: 5, text: "0", value: 0},
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "is",
+			tokens: []token{{tokenSymbol, "Err", 0}, {tokenSymbol, "is", 4}, {tokenAsterisk, "*", 7}, {tokenSymbol, "fs", 8}, {tokenPeriod, ".", 10}, {tokenSymbol, "PathError", 11}},
+			want: &isExpression{
+				expr: &symbolExpression{text: "Err"},
+				typ:  "*fs.PathError",
 			},
 			wantErr: nil,
 		},
@@ -28,14 +72,8 @@ func TestParser(t *testing.T) {
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			tokens := make(chan token)
-			go func() {
-				for _, tok := range tc.tokens {
-					tokens <- tok
-				}
-				close(tokens)
-			}()
-			expr, err := parse(tokens)
+			tokens := tokenList(tc.tokens)
+			expr, err := parse(&tokens)
 			if !errors.Is(err, tc.wantErr) {
 				t.Fatalf("got err %v, want err %v", err, tc.wantErr)
 			}
@@ -45,3 +83,161 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		input string
+
+		wantPos      int
+		wantMsg      string
+		wantExpected []string
+	}{
+		{"A >", 3, "unexpected end of refinement", []string{"'('", "'['", "'!'", "'-'", "'+'", "integer", "string", "identifier"}},
+		{"A B", 2, "unexpected identifier B", []string{"'.'", "'('", "'['", "operator", "'-'", "'+'", "end of refinement"}},
+		{"A.(", 2, "unexpected '('", []string{"identifier"}},
+		{"len(A", 5, "unexpected end of refinement", []string{"'.'", "','", "'('", "')'", "'['", "operator", "'-'", "'+'"}},
+		{"A is []", 7, "unexpected end of refinement", []string{"'['", "'*'", "identifier"}},
+		{"a == `b", 5, "reached EOF when reading string", nil},
+		{"A > 99999999999999999999", 4, "integer 99999999999999999999 is out of range", nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := parse(lex(tc.input))
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("got err %v, want a *ParseError", err)
+			}
+			if !errors.Is(err, ErrParse) {
+				t.Fatalf("got err %v, want it to wrap ErrParse", err)
+			}
+			if pe.Pos != tc.wantPos || pe.Msg != tc.wantMsg || !reflect.DeepEqual(pe.Expected, tc.wantExpected) {
+				t.Fatalf("got %d %q %q, want %d %q %q", pe.Pos, pe.Msg, pe.Expected, tc.wantPos, tc.wantMsg, tc.wantExpected)
+			}
+		})
+	}
+}
+
+func TestParseErrorString(t *testing.T) {
+	pe := &ParseError{Expr: "é\t> )", Pos: 5, Msg: "unexpected ')'", Expected: []string{"identifier"}}
+	want := "could not be parsed: unexpected ')', expected identifier at column 5\n" +
+		"    é\t> )\n" +
+		"     \t  ^"
+	if got := pe.Error(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	err := Check(struct {
+		A int `refine:"A > 0; len(A"`
+	}{A: 1})
+	want = "refine.Check: .A = 1, \"len(A\" could not be parsed: unexpected end of refinement, " +
+		"expected one of '.', ',', '(', ')', '[', operator, '-', '+' at column 6\n" +
+		"    len(A\n" +
+		"         ^"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got\n%v\nwant\n%s", err, want)
+	}
+
+	err = Check(struct {
+		A int `refine:"A > 0 && nope(A)"`
+	}{A: 1})
+	var pe2 *ParseError
+	if !errors.As(err, &pe2) || pe2.Pos != 9 || pe2.Msg != "couldn't find function nope" {
+		t.Fatalf("got %v, want a ParseError at the call", err)
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	testCases := []struct {
+		input string
+
+		wantPos []int
+	}{
+		{"A > 0 && B < 1", nil},
+		{"A >", []int{3}},
+		{"A > && B <", []int{4, 10}},
+		{"A B && C D", []int{2, 9}},
+		{"len(A, ) > 1 && [1 2]", []int{7, 19}},
+		{"(A > ) && B +", []int{5, 13}},
+		{"A ) && B >", []int{2, 10}},
+		{"A[ && B", []int{3, 7}},
+		{"A > > B", []int{4}},
+		{"A.( > 1 || B", []int{2}},
+		{"f(]) || g(,)", []int{2, 10, 11}},
+		{"A == \"x\" && B >", []int{5}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			expr, err := parse(lex(tc.input))
+
+			var got []int
+			switch err := err.(type) {
+			case nil:
+				if expr == nil {
+					t.Fatal("got no expression and no error")
+				}
+			case *ParseError:
+				got = []int{err.Pos}
+			case ParseErrors:
+				for _, pe := range err {
+					got = append(got, pe.Pos)
+				}
+			default:
+				t.Fatalf("got err %T %v, want a ParseError or ParseErrors", err, err)
+			}
+			if !reflect.DeepEqual(got, tc.wantPos) {
+				t.Fatalf("got errors at %v, want %v: %v", got, tc.wantPos, err)
+			}
+			if err != nil && (expr != nil || !errors.Is(err, ErrParse)) {
+				t.Fatalf("got %v, %v; want no expression and an error wrapping ErrParse", expr, err)
+			}
+		})
+	}
+}
+
+func TestParseErrorsString(t *testing.T) {
+	err := Check(struct {
+		A int `refine:"A > && B <"`
+		B int
+	}{})
+	want := "refine.Check: .A = 0, \"A > && B <\" could not be parsed: " +
+		"unexpected '&&', expected one of '(', '[', '!', '-', '+', integer, string, identifier at column 5; " +
+		"unexpected end of refinement, expected one of '(', '[', '!', '-', '+', integer, string, identifier at column 11\n" +
+		"    A > && B <\n" +
+		"        ^     ^"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got\n%v\nwant\n%s", err, want)
+	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Pos != 4 {
+		t.Fatalf("got %v, want the first ParseError", pe)
+	}
+	var pes ParseErrors
+	if !errors.As(err, &pes) || len(pes) != 2 {
+		t.Fatalf("got %v, want ParseErrors", pes)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	predicate := "Quantity > 0 && Price <= $root.MaxPrice || isEmail(Contact) && len(Tags[0]) < 16"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse(lex(predicate)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseErrors(b *testing.B) {
+	predicate := "Quantity > && Price <= $root. || isEmail(Contact && len(Tags[0] < 16"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse(lex(predicate)); err == nil {
+			b.Fatal("parsed a malformed expression")
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 var ErrNotStruct = errors.New("only struct types can be checked")
@@ -12,25 +14,6 @@ var ErrNotMet = errors.New("not met")
 var ErrParse = errors.New("could not be parsed")
 var ErrEval = errors.New("could not be evaluated")
 
-type checkErr struct {
-	structType string
-	fieldName  string
-	fieldValue any
-	refinement string
-	err        error
-}
-
-func (e checkErr) Error() string {
-	return fmt.Sprintf(
-		"refine.Check: %s.%s = %#+v, %q %v",
-		e.structType, e.fieldName, e.fieldValue, e.refinement, e.err,
-	)
-}
-
-func (e checkErr) Unwrap() error {
-	return e.err
-}
-
 const tag = "refine"
 
 var kindMap = map[reflect.Kind]kind{
@@ -46,13 +29,280 @@ var kindMap = map[reflect.Kind]kind{
 	reflect.Uint16:  boxUint,
 	reflect.Uint32:  boxUint,
 	reflect.Uint64:  boxUint,
+	reflect.Float32: boxFloat32,
+	reflect.Float64: boxFloat64,
 	reflect.Slice:   boxSlice,
+	reflect.Array:   boxArray,
 	reflect.Map:     boxMap,
 	reflect.Pointer: boxPointer,
 	reflect.Struct:  boxStruct,
 }
 
-func Check(val any) error {
+// boxValue boxes a value read from a struct so that it can be evaluated.
+// The box records the type of the value, or for interfaces the type of the
+// value they hold.
+func boxValue(value reflect.Value) (box, error) {
+	b, err := newBox(value)
+	if b.typ == nil {
+		b.typ = value.Type()
+	}
+	return b, err
+}
+
+// boxField boxes the value of a field. Values of unsupported types are boxed
+// as boxUnsupported, so that only the refinements referring to them fail.
+func boxField(value reflect.Value) box {
+	b, err := boxValue(value)
+	if errors.Is(err, ErrUnsupportedType) {
+		return box{kind: boxUnsupported, typ: value.Type()}
+	}
+	return b
+}
+
+func newBox(value reflect.Value) (box, error) {
+	kind := value.Kind()
+
+	// Interfaces are boxed according to the value they hold, which must be
+	// narrowed with is before it can be used with most operators.
+	if kind == reflect.Interface {
+		if value.IsNil() {
+			return box{
+				kind:    boxUntypedNilConstant,
+				dynamic: true,
+			}, nil
+		}
+		b, err := boxValue(value.Elem())
+		b.dynamic = true
+		return b, err
+	}
+
+	// Arbitrary-precision numbers are boxed by their type rather than their
+	// kind. A nil pointer to one is still boxed as a pointer so it can be
+	// compared against nil.
+	if bigKind, ok := bigKinds[value.Type()]; ok {
+		return boxBig(bigKind, value)
+	}
+	if kind == reflect.Pointer && !value.IsNil() {
+		if bigKind, ok := bigKinds[value.Type().Elem()]; ok {
+			return boxBig(bigKind, value)
+		}
+	}
+
+	boxKind, ok := kindMap[kind]
+	if !ok {
+		return box{}, fmt.Errorf("%w %s", ErrUnsupportedType, kind.String())
+	}
+
+	if kind == reflect.Pointer && value.IsNil() {
+		return box{
+			kind: boxPointer,
+			val:  nil,
+		}, nil
+	}
+
+	// Basic values are converted to their underlying representation, so
+	// that named types such as `type Port uint16` evaluate like a uint. The
+	// box keeps the named type for error messages and method calls.
+	var val any
+	switch boxKind {
+	case boxBool:
+		val = value.Bool()
+	case boxInt:
+		val = int(value.Int())
+	case boxUint:
+		val = uint(value.Uint())
+	case boxFloat32:
+		val = float32(value.Float())
+	case boxFloat64:
+		val = value.Float()
+	case boxString:
+		val = value.String()
+	default:
+		// Values read from unexported fields can't be converted to an
+		// interface, so they are kept as reflect.Values.
+		if value.CanInterface() {
+			val = value.Interface()
+		} else {
+			val = value
+		}
+	}
+
+	// Integers narrower than int or uint keep their size, so that arithmetic
+	// on them wraps around as it does in Go.
+	var bits int
+	if (boxKind == boxInt || boxKind == boxUint) && value.Type().Bits() < strconv.IntSize {
+		bits = value.Type().Bits()
+	}
+
+	return box{
+		kind: boxKind,
+		val:  val,
+		bits: bits,
+	}, nil
+}
+
+// value returns the value held by a box as a reflect.Value.
+func (b box) value() reflect.Value {
+	if v, ok := b.val.(reflect.Value); ok {
+		return v
+	}
+	return reflect.ValueOf(b.val)
+}
+
+// original returns the value held by a box as its original Go type, undoing
+// the conversion of named types to their underlying representation.
+func (b box) original() any {
+	if b.typ == nil || b.val == nil {
+		return b.val
+	}
+	v := reflect.ValueOf(b.val)
+	if v.Type() != b.typ && v.Type().ConvertibleTo(b.typ) {
+		return v.Convert(b.typ).Interface()
+	}
+	return b.val
+}
+
+// Option configures how refinements are checked.
+type Option func(*config)
+
+type config struct {
+	overflow         bool
+	ignoreUnexported bool
+	groups           map[string]bool
+	maxErrors        int
+	failFast         bool
+	explain          bool
+}
+
+// DetectOverflow makes signed integer arithmetic whose result doesn't fit in
+// the type of its operands, such as int8, an evaluation error wrapping
+// ErrOverflow, instead of wrapping around as it does in Go.
+func DetectOverflow() Option {
+	return func(c *config) {
+		c.overflow = true
+	}
+}
+
+// FailFast makes CheckAll stop at the first refinement that isn't met, as
+// Check does. The error it returns is still an Errors.
+func FailFast() Option {
+	return func(c *config) {
+		c.failFast = true
+	}
+}
+
+// MaxErrors makes CheckAll stop once it has found n errors. Zero or less, the
+// default, means there is no limit.
+func MaxErrors(n int) Option {
+	return func(c *config) {
+		c.maxErrors = n
+	}
+}
+
+// Groups selects groups of refinements to check as well as the default group,
+// which is always checked. A refinement can have clauses in several groups,
+// separated by semicolons and prefixed by the name of their group, e.g.
+//
+//	ID int `refine:"ID >= 0; create: ID == 0; update: ID > 0"`
+func Groups(names ...string) Option {
+	return func(c *config) {
+		groups := make(map[string]bool, len(c.groups)+len(names))
+		for name := range c.groups {
+			groups[name] = true
+		}
+		for _, name := range names {
+			groups[name] = true
+		}
+		c.groups = groups
+	}
+}
+
+// IgnoreUnexported makes unexported fields invisible to refinements: their
+// own refinements aren't checked, other refinements can't refer to them, and
+// the structs they hold aren't checked. By default unexported fields are
+// checked and can be read like exported ones, although methods can only be
+// called on their values if they are booleans, numbers or strings.
+func IgnoreUnexported() Option {
+	return func(c *config) {
+		c.ignoreUnexported = true
+	}
+}
+
+// Checker checks the refinements of struct values using a set of options.
+type Checker struct {
+	config config
+	funcs  funcs
+}
+
+// NewChecker returns a Checker configured with the options provided.
+func NewChecker(opts ...Option) *Checker {
+	c := &Checker{}
+	for _, opt := range opts {
+		opt(&c.config)
+	}
+	return c
+}
+
+var defaultChecker = NewChecker()
+
+// Check checks the refinements of val using the default Checker.
+func Check(val any, opts ...Option) error {
+	return defaultChecker.Check(val, opts...)
+}
+
+// CheckAll checks all the refinements of val using the default Checker.
+func CheckAll(val any, opts ...Option) error {
+	return defaultChecker.CheckAll(val, opts...)
+}
+
+// evalError wraps err with ErrEval, unless it already does so.
+func evalError(err error) error {
+	if errors.Is(err, ErrEval) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrEval, err)
+}
+
+// Check checks the refinements of val, which must be a struct or a pointer to
+// one, and returns an error for the first that isn't met. Options given
+// override those the Checker was created with.
+func (c *Checker) Check(val any, opts ...Option) error {
+	w, err := c.walk(val, false, opts)
+	if err != nil {
+		return err
+	}
+	if len(w.errs) > 0 {
+		return w.errs[0]
+	}
+	return nil
+}
+
+// CheckAll checks the refinements of val like Check, but doesn't stop at the
+// first that isn't met. It returns an Errors with an error for each of them,
+// in the order Check would find them, unless val is not a struct.
+func (c *Checker) CheckAll(val any, opts ...Option) error {
+	w, err := c.walk(val, true, opts)
+	if err != nil {
+		return err
+	}
+	if len(w.errs) > 0 {
+		return w.errs
+	}
+	return nil
+}
+
+// walk checks the refinements of val, collecting the errors found in the
+// walk it returns. Only the first is collected unless all is true.
+func (c *Checker) walk(val any, all bool, opts []Option) (*walk, error) {
+	cfg := c.config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if val == nil {
+		return nil, fmt.Errorf("refine.Check: nil %w", ErrNotStruct)
+	}
+
 	t := func() reflect.Type {
 		t := reflect.TypeOf(val)
 		if t.Kind() == reflect.Pointer {
@@ -67,98 +317,286 @@ func Check(val any) error {
 		if v.Kind() == reflect.Pointer {
 			return v.Elem()
 		} else {
-			return v
+			// Structs given by value are copied, so that their fields are
+			// addressable as they are through a pointer.
+			p := reflect.New(v.Type()).Elem()
+			p.Set(v)
+			return p
 		}
 	}()
 
 	if t.Kind() != reflect.Struct || v.Kind() != reflect.Struct {
-		return fmt.Errorf("refine.Check: %s is a %s, %w", t.Name(), v.Kind().String(), ErrNotStruct)
+		return nil, fmt.Errorf("refine.Check: %s is a %s, %w", t.Name(), v.Kind().String(), ErrNotStruct)
+	}
+
+	w := &walk{cfg: cfg, all: all, seen: map[seenKey]bool{}}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Pointer {
+		w.visit(rv)
 	}
+	c.checkStruct(w, &frame{value: v, path: t.Name()})
+	return w, nil
+}
+
+// StructRefiner is implemented by structs with refinements that apply to the
+// struct as a whole rather than one of its fields. Refinements can also be
+// attached to the struct with the tag of a blank field, e.g.
+//
+//	_ struct{} `refine:"(Email != ``) != (Phone != ``)"`
+type StructRefiner interface {
+	RefineStruct() []string
+}
+
+// checkStruct checks the refinements on the fields of the struct of f, then
+// those on the struct itself, and then descends into the structs its fields
+// hold. It reports whether the walk should stop.
+func (c *Checker) checkStruct(w *walk, f *frame) (stop bool) {
+	t, v := f.value.Type(), f.value
 
 	var ev = newEvaluator()
+	ev.overflow = w.cfg.overflow
+	ev.ignoreUnexported = w.cfg.ignoreUnexported
+	ev.funcs = c.lookupFunc
+
+	// The field and refinement being worked on, so that an internal failure
+	// can be reported against them instead of panicking in the caller. It is
+	// reported against the struct when no refinement is being worked on.
+	var fieldName, refinement string
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%w: internal error: %v", ErrEval, r)
+			if refinement == "" {
+				stop = w.fail(fmt.Errorf("refine.Check: %s %w", f.path, err))
+				return
+			}
+			stop = w.fail(fieldError(f, ev, fieldName, clause{expr: refinement}, KindEval, err))
+		}
+	}()
 
 	n := t.NumField()
 
 	// Populate the symbol table with values from the struct's fields.
 	for i := 0; i < n; i++ {
 		field := t.Field(i)
-		kind := field.Type.Kind()
 		value := v.Field(i)
 
-		boxKind, ok := kindMap[kind]
-		if !ok {
-			return fmt.Errorf("refine.Check: %s.%s %w %s", t.Name(), field.Name, ErrUnsupportedType, kind.String())
-		}
-
-		if kind == reflect.Pointer {
-			if value.IsNil() {
-				ev.symbols[field.Name] = box{
-					kind: boxPointer,
-					val:  nil,
-				}
-			} else {
-				ev.symbols[field.Name] = box{
-					kind: boxKind,
-					val:  value.Interface(),
-				}
-			}
-		} else {
-			ev.symbols[field.Name] = box{
-				kind: boxKind,
-				val:  value.Interface(),
-			}
+		if field.Name == "_" || !w.visible(field) {
+			continue
+		}
+
+		ev.symbols[field.Name] = boxField(value)
+	}
+
+	// Fields promoted from embedded structs are referred to by their own
+	// names, unless a shallower field hides them as it does in Go.
+	for _, field := range reflect.VisibleFields(t) {
+		if len(field.Index) == 1 || !w.visible(field) {
+			continue
+		}
+		value, err := v.FieldByIndexErr(field.Index)
+		if err != nil {
+			// The field is in a struct embedded by a nil pointer.
+			continue
 		}
+		ev.symbols[field.Name] = boxField(value)
+	}
+
+	if err := f.bind(ev.symbols); err != nil {
+		return w.fail(fmt.Errorf("refine.Check: %s %w", f.path, err))
 	}
 
 	// Parse and evaluate the refinements on each field.
+	var blanks []reflect.StructField
 	for i := 0; i < n; i++ {
 		field := t.Field(i)
-		refinement := field.Tag.Get(tag)
-		tokens := lex(field.Name, refinement)
+		if field.Name == "_" {
+			blanks = append(blanks, field)
+			continue
+		}
 
-		expr, err := parse(tokens)
-		if err != nil {
-			return checkErr{
-				structType: t.Name(),
-				fieldName:  field.Name,
-				fieldValue: ev.symbols[field.Name].val,
-				refinement: refinement,
-				err:        fmt.Errorf("%w: %v", ErrParse, err),
-			}
+		// Untagged fields, including embedded structs, are only read by the
+		// refinements that refer to them.
+		ft := parseTag(field)
+		if !ft.tagged || ft.skip || !w.visible(field) {
+			continue
 		}
 
-		expr.Accept(ev)
-		result, err := ev.Result, ev.Err
-		if err != nil {
-			return checkErr{
-				structType: t.Name(),
-				fieldName:  field.Name,
-				fieldValue: ev.symbols[field.Name].val,
-				refinement: refinement,
-				err:        fmt.Errorf("%w: %v", ErrEval, err),
+		fieldName, refinement = field.Name, ft.refinement
+		value := v.Field(i)
+		if err := ft.validate(field.Type); err != nil {
+			if w.fail(fieldError(f, ev, fieldName, clause{expr: field.Tag.Get(tag)}, KindParse, err)) {
+				return true
 			}
+			continue
 		}
-
-		if result.kind != boxBool {
-			return checkErr{
-				structType: t.Name(),
-				fieldName:  field.Name,
-				fieldValue: ev.symbols[field.Name].val,
-				refinement: refinement,
-				err:        fmt.Errorf("%w: %v", ErrEval, "not bool"),
+		if ft.omitEmpty && value.IsZero() {
+			continue
+		}
+		if ft.required && value.IsNil() {
+			// The refinement of a missing field isn't checked.
+			err := fieldError(f, ev, fieldName, clause{expr: field.Tag.Get(tag)}, KindNotMet, ErrRequired)
+			if w.fail(customize(err, ev, field)) {
+				return true
 			}
+			continue
+		}
+		if refinement == "" {
+			continue
 		}
 
-		if result.val.(bool) != true {
-			return checkErr{
-				structType: t.Name(),
-				fieldName:  field.Name,
-				fieldValue: ev.symbols[field.Name].val,
-				refinement: refinement,
-				err:        ErrNotMet,
+		if c.checkClauses(w, ev, f, &field, refinement) {
+			return true
+		}
+	}
+
+	// Then those on the struct as a whole, which blank fields can give
+	// messages and codes to.
+	fieldName = ""
+	for i := range blanks {
+		refinement = blanks[i].Tag.Get(tag)
+		if c.checkClauses(w, ev, f, &blanks[i], refinement) {
+			return true
+		}
+	}
+	if r, ok := refinerOf(v); ok {
+		refinement = ""
+		for _, refinement = range r.RefineStruct() {
+			if c.checkClauses(w, ev, f, nil, refinement) {
+				return true
 			}
 		}
 	}
 
+	refinement = ""
+	for i := 0; i < n; i++ {
+		field := t.Field(i)
+		if field.Name == "_" || !w.visible(field) {
+			continue
+		}
+		if ft := parseTag(field); ft.skip || ft.omitEmpty && v.Field(i).IsZero() {
+			continue
+		}
+		if c.descend(w, f, joinPath(f.path, field.Name), v.Field(i)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refinerOf returns v as a StructRefiner if its type, or a pointer to it,
+// implements the interface. Methods with pointer receivers are called on a
+// copy of v.
+func refinerOf(v reflect.Value) (StructRefiner, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if r, ok := v.Interface().(StructRefiner); ok {
+		return r, true
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	r, ok := p.Interface().(StructRefiner)
+	return r, ok
+}
+
+// checkClauses checks the clauses of a refinement that are in the default
+// group or in one of the groups selected with Groups. The refinement is on
+// field, which may be blank, or on the struct itself if field is nil. It
+// reports whether the walk should stop.
+func (c *Checker) checkClauses(w *walk, ev *evaluator, f *frame, field *reflect.StructField, refinement string) bool {
+	var name string
+	if field != nil && field.Name != "_" {
+		name = field.Name
+	}
+	for _, cl := range splitClauses(refinement) {
+		if cl.group != "" && !w.cfg.groups[cl.group] {
+			continue
+		}
+		err := c.checkRefinement(w, ev, f, name, refinement, cl)
+		if err == nil {
+			continue
+		}
+		if field != nil {
+			err = customize(err, ev, *field)
+		}
+		if w.fail(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRefinement parses and evaluates a clause of a refinement on the field
+// called name, or on the struct itself if name is empty.
+func (c *Checker) checkRefinement(w *walk, ev *evaluator, f *frame, name, refinement string, cl clause) error {
+	expr, err := parse(lex(cl.expr))
+	if err == nil {
+		err = checkCalls(expr, ev.symbols, c.lookupFunc)
+	}
+	switch e := err.(type) {
+	case nil:
+	case *ParseError:
+		e.Expr = cl.expr
+	case ParseErrors:
+		for _, pe := range e {
+			pe.Expr = cl.expr
+		}
+	default:
+		err = fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	if err != nil {
+		return fieldError(f, ev, name, cl, KindParse, err)
+	}
+
+	ev.notes = nil
+	expr.Accept(ev)
+	result, err := ev.Result, ev.Err
+	if err != nil {
+		fe := fieldError(f, ev, name, cl, KindEval, evalError(err))
+		fe.resolved = f.resolved(cl.expr)
+		if w.cfg.explain {
+			fe.explanation = explain(ev, refinement, cl, expr)
+		}
+		return fe
+	}
+
+	if result.kind != boxBool {
+		return fieldError(f, ev, name, cl, KindEval, fmt.Errorf("%w: %v", ErrEval, "not bool"))
+	}
+
+	if result.val.(bool) != true {
+		err = ErrNotMet
+		if len(ev.notes) > 0 {
+			err = fmt.Errorf("%w: %s", ErrNotMet, strings.Join(ev.notes, "; "))
+		}
+		fe := fieldError(f, ev, name, cl, KindNotMet, err)
+		fe.resolved = f.resolved(cl.expr)
+		if w.cfg.explain {
+			fe.explanation = explain(ev, refinement, cl, expr)
+		}
+		return fe
+	}
+
 	return nil
 }
+
+// fieldError returns an error of the given kind for the clause cl of a
+// refinement on the field called name of the struct of f, or on the struct
+// itself if name is empty.
+func fieldError(f *frame, ev *evaluator, name string, cl clause, kind ErrorKind, err error) *FieldError {
+	path := f.path
+	if name != "" {
+		path += "." + name
+	}
+	return &FieldError{
+		Struct:     f.value.Type().Name(),
+		Field:      name,
+		Path:       path,
+		Value:      ev.symbols[name].original(),
+		Refinement: cl.String(),
+		Kind:       kind,
+		Clause:     cl.index,
+		Offset:     cl.offset,
+		err:        err,
+	}
+}
@@ -2,6 +2,11 @@ package refine
 
 import (
 	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +34,45 @@ func TestCheck(t *testing.T) {
 		} `refine:"C.A == nil"`
 	}
 
+	type checkBig struct {
+		I *big.Int  `refine:"I * 2 > 10"`
+		F big.Float `refine:"F / 4 < 1"`
+		R *big.Rat  `refine:"-R <= 1"`
+		N int       `refine:"bigInt(N) < I"`
+		P *big.Int  `refine:"P == nil"`
+		U uint8     `refine:"bigRat(U) != R"`
+	}
+
+	type checkUnexported struct {
+		A int `refine:"A > 0"`
+		b int
+	}
+
+	type checkUnexportedTagged struct {
+		A int `refine:"A > 0"`
+		b int `refine:"b > 0"`
+	}
+
+	type address struct {
+		Street string
+		Lines  []string
+	}
+
+	type checkEqual struct {
+		Tags      []string       "refine:\"Tags == [`a`, `b`]\""
+		Primary   address        `refine:"Primary == Secondary"`
+		Secondary address        `refine:"(Secondary != Primary) == false"`
+		Counts    map[string]int `refine:"Counts == Same"`
+		Same      map[string]int `refine:"Same != nil"`
+		P         *int           `refine:"P != Q"`
+		Q         *int           `refine:"deepEqual(P, Q)"`
+	}
+
+	type checkSlices struct {
+		A []int `refine:"A == B"`
+		B []int `refine:"B != nil"`
+	}
+
 	testCases := []struct {
 		name  string
 		value any
@@ -41,6 +85,84 @@ func TestCheck(t *testing.T) {
 
 			want: ErrNotStruct,
 		},
+		{
+			name:  "NilErr",
+			value: nil,
+
+			want: ErrNotStruct,
+		},
+		{
+			name:  "NilPointerErr",
+			value: (*checkDependent)(nil),
+
+			want: ErrNotStruct,
+		},
+		{
+			name:  "UnexportedUntagged",
+			value: checkUnexported{A: 1, b: 1},
+
+			want: nil,
+		},
+		{
+			name:  "UnexportedTagged",
+			value: checkUnexportedTagged{A: 1, b: 0},
+
+			want: ErrNotMet,
+		},
+		{
+			name:  "SlicesEqual",
+			value: checkSlices{A: []int{1}, B: []int{1}},
+
+			want: nil,
+		},
+		{
+			name:  "SlicesNotEqual",
+			value: checkSlices{A: []int{1}, B: []int{2}},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "DeepEquality",
+			value: checkEqual{
+				Tags:      []string{"a", "b"},
+				Primary:   address{Street: "Main", Lines: []string{"1"}},
+				Secondary: address{Street: "Main", Lines: []string{"1"}},
+				Counts:    map[string]int{"a": 1},
+				Same:      map[string]int{"a": 1},
+				P:         new(int),
+				Q:         new(int),
+			},
+
+			want: nil,
+		},
+		{
+			name: "DeepEqualityNotMet",
+			value: checkEqual{
+				Tags:      []string{"a", "b"},
+				Primary:   address{Street: "Main", Lines: []string{"1"}},
+				Secondary: address{Street: "Main", Lines: []string{"2"}},
+				Counts:    map[string]int{"a": 1},
+				Same:      map[string]int{"a": 1},
+				P:         new(int),
+				Q:         new(int),
+			},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "ListMismatch",
+			value: struct {
+				Tags []string `refine:"Tags == [1]"`
+			}{Tags: []string{"a"}},
+
+			want: ErrEval,
+		},
+		{
+			name:  "NilSliceNotMet",
+			value: checkNil{A: new(int), D: nil, E: map[int]string{}},
+
+			want: ErrNotMet,
+		},
 		{
 			name: "DependentFields",
 			value: checkDependent{
@@ -93,8 +215,627 @@ func TestCheck(t *testing.T) {
 				C: struct{ A *int }{A: nil},
 			},
 
+			want: nil,
+		},
+		{
+			name: "BigMet",
+			value: &checkBig{
+				I: big.NewInt(6),
+				F: *big.NewFloat(3.5),
+				R: big.NewRat(-1, 2),
+				N: 5,
+				U: 1,
+			},
+
+			want: nil,
+		},
+		{
+			name: "BigNotMet",
+			value: checkBig{
+				I: big.NewInt(6),
+				F: *big.NewFloat(3.5),
+				R: big.NewRat(-1, 2),
+				N: 6,
+				U: 1,
+			},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "BigMismatch",
+			value: struct {
+				I *big.Int `refine:"I > N"`
+				N int
+			}{
+				I: big.NewInt(6),
+			},
+
+			want: ErrEval,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type (
+	port     uint16
+	email    string
+	status   int8
+	ratio    float32
+	duration int64
+)
+
+func TestCheckNamedTypes(t *testing.T) {
+	type checkNamed struct {
+		Port    port     `refine:"Port > 1024 && Port != 8080"`
+		Email   email    "refine:\"Email != ``\""
+		Status  status   `refine:"Status >= -1 && Status <= 1"`
+		Ratio   ratio    `refine:"Ratio < 1"`
+		Timeout duration `refine:"Timeout / 1000 > 0"`
+		Any     any      `refine:"Any is port && Any == Port"`
+	}
+
+	testCases := []struct {
+		name  string
+		value checkNamed
+
+		want error
+	}{
+		{"Met", checkNamed{Port: 2048, Email: "a@b", Status: -1, Ratio: 0.5, Timeout: 1000, Any: port(2048)}, nil},
+		{"PortNotMet", checkNamed{Port: 8080, Email: "a@b", Ratio: 0.5, Timeout: 1000, Any: port(8080)}, ErrNotMet},
+		{"AnyNotMet", checkNamed{Port: 2048, Email: "a@b", Ratio: 0.5, Timeout: 1000, Any: uint16(2048)}, ErrNotMet},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Errors describe values and types by their original named types.
+	err := Check(struct {
+		Port  port  `refine:"Port == Email"`
+		Email email `refine:"true"`
+	}{Port: 80, Email: "a@b"})
+	if !errors.Is(err, ErrEval) || !strings.Contains(err.Error(), "refine.port != refine.email") {
+		t.Fatalf("got %v; want a type mismatch between refine.port and refine.email", err)
+	}
+	if !strings.Contains(err.Error(), "Port = 0x50") {
+		t.Fatalf("got %v; want the port value as its named type", err)
+	}
+
+	// Values of different named types are unequal, even with the same
+	// underlying type, and can't be compared with ==.
+	deep := struct {
+		Port port
+		U16  uint16 `refine:"!deepEqual(Port, U16)"`
+	}{Port: 80, U16: 80}
+	if err := Check(deep); err != nil {
+		t.Fatalf("got %v; want deepEqual to be false", err)
+	}
+	err = Check(struct {
+		Port port
+		U16  uint16 `refine:"Port == U16"`
+	}{Port: 80, U16: 80})
+	if !errors.Is(err, ErrEval) || !strings.Contains(err.Error(), "refine.port != uint16") {
+		t.Fatalf("got %v; want a type mismatch between refine.port and uint16", err)
+	}
+}
+
+func TestCheckArrays(t *testing.T) {
+	type checkArrays struct {
+		ID     [4]byte    `refine:"len(ID) == 4 && any(ID, b, b != 0) && ID != [0, 0, 0, 0]"`
+		Vector [3]float64 `refine:"all(Vector, x, x >= 0) && Vector[0] < Vector[2]"`
+		Same   [3]float64 `refine:"Same == Vector"`
+		Tags   []string   "refine:\"len(Tags) > 0 && Tags[len(Tags) - 1] != `` && all(Tags, t, len(t) < 8)\""
+	}
+
+	testCases := []struct {
+		name  string
+		value checkArrays
+
+		want error
+	}{
+		{
+			name: "Met",
+			value: checkArrays{
+				ID:     [4]byte{0, 1, 0, 0},
+				Vector: [3]float64{0, 1, 2},
+				Same:   [3]float64{0, 1, 2},
+				Tags:   []string{"a", "b"},
+			},
+
+			want: nil,
+		},
+		{
+			name: "ZeroID",
+			value: checkArrays{
+				Vector: [3]float64{0, 1, 2},
+				Same:   [3]float64{0, 1, 2},
+				Tags:   []string{"a", "b"},
+			},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "NegativeElement",
+			value: checkArrays{
+				ID:     [4]byte{1},
+				Vector: [3]float64{0, -1, 2},
+				Same:   [3]float64{0, -1, 2},
+				Tags:   []string{"a", "b"},
+			},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "ArraysNotEqual",
+			value: checkArrays{
+				ID:     [4]byte{1},
+				Vector: [3]float64{0, 1, 2},
+				Same:   [3]float64{0, 1, 3},
+				Tags:   []string{"a", "b"},
+			},
+
+			want: ErrNotMet,
+		},
+		{
+			name: "EmptyTags",
+			value: checkArrays{
+				ID:     [4]byte{1},
+				Vector: [3]float64{0, 1, 2},
+				Same:   [3]float64{0, 1, 2},
+			},
+
+			want: ErrNotMet,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	err := Check(struct {
+		Tags []string `refine:"Tags[2] == Tags[0]"`
+	}{Tags: []string{"a"}})
+	if !errors.Is(err, ErrEval) {
+		t.Fatalf("got %v; want %v", err, ErrEval)
+	}
+}
+
+var errVersion = errors.New("invalid version")
+
+type (
+	testEmail   string
+	testID      [4]byte
+	testVersion string
+)
+
+func (e testEmail) Domain() string {
+	return string(e)[strings.LastIndex(string(e), "@")+1:]
+}
+
+func (id *testID) IsZero() bool {
+	return *id == testID{}
+}
+
+func (v testVersion) Major() (int, error) {
+	major, _, _ := strings.Cut(strings.TrimPrefix(string(v), "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, errVersion
+	}
+	return n, nil
+}
+
+func (v testVersion) Before(major int, minor uint8) bool {
+	n, _ := v.Major()
+	return n < major
+}
+
+func (v testVersion) Parts() []string {
+	return strings.Split(string(v), ".")
+}
+
+func (v testVersion) Split(sep []string) string {
+	return ""
+}
+
+func TestCheckMethods(t *testing.T) {
+	type checkMethods struct {
+		ID      testID      `refine:"!ID.IsZero()"`
+		Version testVersion `refine:"Version.Major() >= 2 && !Version.Before(2, 0) && len(Version.Parts()) > 1"`
+		Email   testEmail   "refine:\"Email.Domain() == `example.com`\""
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want error
+	}{
+		{"Met", checkMethods{ID: testID{1}, Version: "v2.1", Email: "a@example.com"}, nil},
+		{"PointerReceiver", &checkMethods{ID: testID{}, Version: "v2.1", Email: "a@example.com"}, ErrNotMet},
+		{"VersionNotMet", checkMethods{ID: testID{1}, Version: "v1.0", Email: "a@example.com"}, ErrNotMet},
+		{"EmailNotMet", checkMethods{ID: testID{1}, Version: "v2.0", Email: "a@example.org"}, ErrNotMet},
+		{"ErrorResult", checkMethods{ID: testID{1}, Version: "bad", Email: "a@example.com"}, errVersion},
+		{"ErrorResultIsEval", checkMethods{ID: testID{1}, Version: "bad", Email: "a@example.com"}, ErrEval},
+		{"NoMethod", struct {
+			V testVersion `refine:"V.Minor() > 0"`
+		}{V: "v1.0"}, ErrEval},
+		{"DisallowedParameter", struct {
+			V testVersion "refine:\"V.Split([`.`]) == ``\""
+		}{V: "v1.0"}, ErrEval},
+		{"ArgumentOverflow", struct {
+			V testVersion `refine:"V.Before(1, 256)"`
+		}{V: "v1.0"}, ErrEval},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Errors returned by methods are described like other causes.
+	want := `refine.Check: .V = "bad", "V.Major() > 0" could not be evaluated: Major returned an error: ` + errVersion.Error()
+	err := Check(struct {
+		V testVersion `refine:"V.Major() > 0"`
+	}{V: "bad"})
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v; want %s", err, want)
+	}
+}
+
+func TestCheckInterface(t *testing.T) {
+	type valueError struct{ Code int }
+
+	type checkValue struct {
+		Value any `refine:"Value is int && Value > 0 || Value is string"`
+	}
+
+	type checkErr struct {
+		Err error `refine:"Err == nil"`
+	}
+
+	type checkNotNarrowed struct {
+		Value any `refine:"Value > 0"`
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want error
+	}{
+		{"IntMet", checkValue{Value: 1}, nil},
+		{"IntNotMet", checkValue{Value: -1}, ErrNotMet},
+		{"String", checkValue{Value: "foo"}, nil},
+		{"Nil", checkValue{Value: nil}, ErrNotMet},
+		{"OtherType", checkValue{Value: true}, ErrNotMet},
+		{"NilError", checkErr{Err: nil}, nil},
+		{"Error", checkErr{Err: errors.New("foo")}, ErrNotMet},
+		{"NilPointerError", checkErr{Err: (*ArithmeticError)(nil)}, ErrNotMet},
+		{"NotNarrowed", checkNotNarrowed{Value: 1}, ErrEval},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	type checkIs struct {
+		A any `refine:"A is *ArithmeticError && B is error && C is []string && D is refine.valueError"`
+		B any `refine:"!(B is valueError) && (B == C) == false"`
+		C any `refine:"C == C"`
+		D any `refine:"D == D"`
+	}
+
+	err := Check(checkIs{
+		A: &ArithmeticError{},
+		B: &ArithmeticError{},
+		C: []string{"a"},
+		D: valueError{Code: 1},
+	})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+}
+
+func FuzzCheck(f *testing.F) {
+	testCases := []string{
+		"A > 0",
+		"A / 0 > 1",
+		"B == `foo`",
+		"C == C",
+		"D != nil",
+		"E == nil",
+		"F << 100000000 > F",
+		"bigInt(B) > F",
+		"-A % 0 == 1",
+		"G",
+	}
+
+	for _, tc := range testCases {
+		f.Add(tc, 1, "foo")
+	}
+
+	f.Fuzz(func(t *testing.T, refinement string, a int, b string) {
+		typ := reflect.StructOf([]reflect.StructField{
+			{Name: "A", Type: reflect.TypeOf(int(0)), Tag: reflect.StructTag(`refine:` + strconv.Quote(refinement))},
+			{Name: "B", Type: reflect.TypeOf(""), Tag: `refine:"true"`},
+			{Name: "C", Type: reflect.TypeOf([]string{}), Tag: `refine:"true"`},
+			{Name: "D", Type: reflect.TypeOf(map[string]int{}), Tag: `refine:"true"`},
+			{Name: "E", Type: reflect.TypeOf(new(int)), Tag: `refine:"true"`},
+			{Name: "F", Type: reflect.TypeOf(new(big.Int)), Tag: `refine:"true"`},
+			{Name: "G", Type: reflect.TypeOf(false), Tag: `refine:"true"`},
+		})
+
+		v := reflect.New(typ).Elem()
+		v.Field(0).SetInt(int64(a))
+		v.Field(1).SetString(b)
+		v.Field(2).Set(reflect.ValueOf([]string{b}))
+		v.Field(3).Set(reflect.ValueOf(map[string]int{b: a}))
+		v.Field(5).Set(reflect.ValueOf(big.NewInt(int64(a))))
+
+		// Check must never panic, including when the panic is recovered and
+		// reported as an internal error, and every error it returns must be
+		// one of the documented kinds.
+		err := Check(v.Interface())
+		if err == nil {
+			return
+		}
+		if strings.Contains(err.Error(), "internal error") {
+			t.Fatalf("got a panic: %v", err)
+		}
+		for _, want := range []error{ErrParse, ErrEval, ErrNotMet, ErrUnsupportedType} {
+			if errors.Is(err, want) {
+				return
+			}
+		}
+		t.Fatalf("got undocumented error %v", err)
+	})
+}
+
+func TestCheckArithmetic(t *testing.T) {
+	type checkAverage struct {
+		Total int `refine:"Total / Count > 3"`
+		Count int `refine:"Count >= 0"`
+	}
+
+	type checkSum struct {
+		A int `refine:"A + B > A"`
+		B int `refine:"B > 0"`
+	}
+
+	type checkNarrow struct {
+		A int8  `refine:"A + 1 > 0"`
+		B int32 `refine:"B * 2 > 0"`
+		C uint8 `refine:"C + 1 > C"`
+		D int16 `refine:"-D > 0"`
+	}
+
+	type checkShift struct {
+		A  int   `refine:"A >> U8 == 1 && A << N > 0"`
+		U8 uint8 `refine:"-U8 == 255"`
+		N  int
+	}
+
+	type checkBigQuo struct {
+		X *big.Rat `refine:"X / Y > 0"`
+		Y *big.Rat `refine:"Y != nil"`
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+		opts  []Option
+
+		want error
+	}{
+		{
+			name:  "DivideByZero",
+			value: checkAverage{Total: 10, Count: 0},
+
+			want: ErrDivideByZero,
+		},
+		{
+			name:  "DivideByZeroIsEval",
+			value: checkAverage{Total: 10, Count: 0},
+
 			want: ErrEval,
 		},
+		{
+			name:  "BigDivideByZero",
+			value: checkBigQuo{X: big.NewRat(1, 2), Y: new(big.Rat)},
+
+			want: ErrDivideByZero,
+		},
+		{
+			name:  "OverflowWraps",
+			value: checkSum{A: math.MaxInt, B: 1},
+
+			want: ErrNotMet,
+		},
+		{
+			name:  "OverflowDetected",
+			value: checkSum{A: math.MaxInt, B: 1},
+			opts:  []Option{DetectOverflow()},
+
+			want: ErrOverflow,
+		},
+		{
+			name:  "NoOverflow",
+			value: checkSum{A: 1, B: 1},
+			opts:  []Option{DetectOverflow()},
+
+			want: nil,
+		},
+		{
+			name:  "UnsignedShiftCount",
+			value: checkShift{A: 2, U8: 1, N: 1},
+
+			want: nil,
+		},
+		{
+			name:  "NegativeShiftCount",
+			value: checkShift{A: 2, U8: 1, N: -1},
+
+			want: ErrShiftCount,
+		},
+		{
+			name:  "Int8Wraps",
+			value: checkNarrow{A: math.MaxInt8, B: 1, C: 1, D: -1},
+
+			want: ErrNotMet,
+		},
+		{
+			name:  "Int8OverflowDetected",
+			value: checkNarrow{A: math.MaxInt8, B: 1, C: 1, D: -1},
+			opts:  []Option{DetectOverflow()},
+
+			want: ErrOverflow,
+		},
+		{
+			name:  "Int32Wraps",
+			value: checkNarrow{A: 1, B: 1 << 30, C: 1, D: -1},
+
+			want: ErrNotMet,
+		},
+		{
+			name:  "Int32OverflowDetected",
+			value: checkNarrow{A: 1, B: 1 << 30, C: 1, D: -1},
+			opts:  []Option{DetectOverflow()},
+
+			want: ErrOverflow,
+		},
+		{
+			name:  "Uint8Wraps",
+			value: checkNarrow{A: 1, B: 1, C: math.MaxUint8, D: -1},
+			opts:  []Option{DetectOverflow()},
+
+			want: ErrNotMet,
+		},
+		{
+			name:  "Int16NegateOverflowDetected",
+			value: checkNarrow{A: 1, B: 1, C: 1, D: math.MinInt16},
+			opts:  []Option{DetectOverflow()},
+
+			want: ErrOverflow,
+		},
+		{
+			name:  "NarrowNoOverflow",
+			value: checkNarrow{A: math.MaxInt8 - 1, B: 1<<30 - 1, C: 1, D: -1},
+			opts:  []Option{DetectOverflow()},
+
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value, tc.opts...)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+
+	var arithErr *ArithmeticError
+	if err := Check(checkAverage{Total: 10}); !errors.As(err, &arithErr) || arithErr.Op != "/" {
+		t.Fatalf("got %v; want an *ArithmeticError for '/'", err)
+	}
+
+	// The operation follows the text of ErrEval, as with other causes.
+	want := `refine.Check: checkAverage.Total = 10, "Total / Count > 3" could not be evaluated: 10 / 0: division by zero`
+	if err := Check(checkAverage{Total: 10}); err == nil || err.Error() != want {
+		t.Fatalf("got %v; want %s", err, want)
+	}
+}
+
+type testContact struct {
+	Email string   "refine:\"Email == `` || isEmail(Email)\""
+	Phone string   `refine:"len(Phone) <= 16"`
+	_     struct{} "refine:\"(Email != ``) != (Phone != ``)\""
+}
+
+type testRange struct {
+	Min int `refine:"Min >= 0"`
+	Max int `refine:"Max >= 0"`
+}
+
+func (r *testRange) RefineStruct() []string {
+	return []string{"Min <= Max", "Max - Min < 100"}
+}
+
+type testPanicky struct {
+	A int `refine:"A > 0"`
+}
+
+func (p testPanicky) RefineStruct() []string {
+	panic("boom")
+}
+
+func TestCheckPanic(t *testing.T) {
+	// A panic outside any refinement is reported against the struct, not the
+	// last refinement checked.
+	want := "refine.Check: testPanicky could not be evaluated: internal error: boom"
+	err := Check(testPanicky{A: 1})
+	if !errors.Is(err, ErrEval) || err.Error() != want {
+		t.Fatalf("got %v; want %s", err, want)
+	}
+}
+
+func TestCheckStructRefinements(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value any
+
+		want     error
+		wantText string
+	}{
+		{"BlankFieldMet", testContact{Email: "a@example.com"}, nil, ""},
+		{"BlankFieldNotMet", testContact{Email: "a@example.com", Phone: "123"}, ErrNotMet, "refine.Check: testContact \"(Email != ``) != (Phone != ``)\" not met"},
+		{"FieldsFirst", testContact{Email: "a"}, ErrNotMet, "testContact.Email"},
+		{"MethodMet", testRange{Min: 1, Max: 2}, nil, ""},
+		{"MethodNotMet", &testRange{Min: 2, Max: 1}, ErrNotMet, "refine.Check: testRange \"Min <= Max\" not met"},
+		{"MethodSecondNotMet", testRange{Min: 0, Max: 100}, ErrNotMet, "\"Max - Min < 100\""},
+		{"BlankFieldUntagged", struct {
+			A int `refine:"A == 0"`
+			_ int
+		}{}, nil, ""},
+		{"ParseError", struct {
+			A int      `refine:"A == 0"`
+			_ struct{} `refine:"A =="`
+		}{}, ErrParse, ""},
 	}
 
 	for _, tc := range testCases {
@@ -104,6 +845,366 @@ func TestCheck(t *testing.T) {
 			if !errors.Is(got, tc.want) {
 				t.Fatalf("got %v; want %v", got, tc.want)
 			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
 		})
 	}
 }
+
+type (
+	TestAudit struct {
+		ID        int `refine:"ID >= 0"`
+		CreatedAt int `refine:"CreatedAt > 0"`
+		UpdatedAt int `refine:"UpdatedAt >= CreatedAt"`
+	}
+
+	testOwner struct {
+		Owner string "refine:\"Owner != ``\""
+	}
+
+	testLabel struct {
+		Label string `refine:"true"`
+	}
+
+	testUser struct {
+		TestAudit
+		*testOwner
+		testLabel
+		ID   string "refine:\"ID != ``\""
+		Name string "refine:\"Name != Owner && UpdatedAt >= CreatedAt && Label == `` && TestAudit.ID > 0\""
+	}
+)
+
+func TestCheckEmbedded(t *testing.T) {
+	valid := func() testUser {
+		return testUser{
+			TestAudit: TestAudit{ID: 1, CreatedAt: 1, UpdatedAt: 2},
+			testOwner: &testOwner{Owner: "a"},
+			ID:        "u1",
+			Name:      "b",
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(u *testUser)
+
+		want     error
+		wantText string
+	}{
+		{"Met", func(u *testUser) {}, nil, ""},
+		{"Promoted", func(u *testUser) { u.Name = "a" }, ErrNotMet, "testUser.Name"},
+		{"EmbeddedRefinement", func(u *testUser) { u.CreatedAt = 0; u.UpdatedAt = 0 }, ErrNotMet, "testUser.TestAudit.CreatedAt"},
+		{"Shadowed", func(u *testUser) { u.TestAudit.ID = 0 }, ErrNotMet, "testUser.Name"},
+		{"ShadowedRefinement", func(u *testUser) { u.ID = "" }, ErrNotMet, "testUser.ID"},
+		{"UnexportedPointer", func(u *testUser) { u.testOwner.Owner = "" }, ErrNotMet, "testUser.testOwner.Owner"},
+		{"NilPointer", func(u *testUser) { u.testOwner = nil }, ErrEval, "Owner"},
+		{"UnexportedValue", func(u *testUser) { u.Label = "x" }, ErrNotMet, "testUser.Name"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			u := valid()
+			tc.modify(&u)
+			got := Check(u)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+func TestCheckTagOptions(t *testing.T) {
+	type options struct {
+		Ch       chan int
+		Skipped  int      `refine:"-"`
+		Optional string   `refine:"len(Optional) > 2,omitempty"`
+		Tags     []string `refine:"len(Tags) < 3,required"`
+		Parent   *int     `refine:"required"`
+		Nested   testLine `refine:"-"`
+	}
+
+	one := 1
+	valid := func() options {
+		return options{Skipped: -1, Tags: []string{}, Parent: &one}
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(o *options)
+		value  any
+
+		want error
+	}{
+		{"Met", func(o *options) {}, nil, nil},
+		{"OmitEmptySet", func(o *options) { o.Optional = "ab" }, nil, ErrNotMet},
+		{"RequiredNil", func(o *options) { o.Tags = nil }, nil, ErrRequired},
+		{"RequiredIsNotMet", func(o *options) { o.Parent = nil }, nil, ErrNotMet},
+		{"RequiredRefinement", func(o *options) { o.Tags = []string{"a", "b", "c"} }, nil, ErrNotMet},
+		{"SkippedNested", func(o *options) { o.Nested.Price = -1 }, nil, nil},
+		{"UnsupportedReferenced", nil, struct {
+			Ch chan int `refine:"Ch != nil"`
+		}{}, ErrEval},
+		{"RequiredNotNilable", nil, struct {
+			A int `refine:"required"`
+		}{}, ErrParse},
+		{"RequiredAndOmitEmpty", nil, struct {
+			A *int `refine:"omitempty,required"`
+		}{}, ErrParse},
+		{"OmitEmptyNested", nil, struct {
+			Line testLine `refine:",omitempty"`
+		}{}, nil},
+		{"EmptyNested", nil, struct {
+			Line testLine `refine:""`
+		}{}, ErrNotMet},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			value := tc.value
+			if tc.modify != nil {
+				o := valid()
+				tc.modify(&o)
+				value = o
+			}
+			got := Check(value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type testCounter struct {
+	count  int              `refine:"count >= 0"`
+	limits []int            `refine:"len(limits) == 0 || limits[0] >= count"`
+	parent *testCounter     `refine:"parent == nil || parent.count >= count"`
+	lines  map[int]testLine `refine:"true"`
+	email  testEmail        "refine:\"email == `` || email.Domain() != ``\""
+	total  *big.Int         `refine:"true"`
+}
+
+func TestCheckUnexported(t *testing.T) {
+	type samePointer struct {
+		P *int `refine:"P == q"`
+		q *int `refine:"!(q != P)"`
+	}
+	n, m := 1, 1
+
+	testCases := []struct {
+		name  string
+		value any
+		opts  []Option
+
+		want error
+	}{
+		{"Met", testCounter{count: 1, limits: []int{2}, parent: &testCounter{count: 2}}, []Option{IgnoreUnexported()}, nil},
+		{"NotMet", testCounter{count: -1}, nil, ErrNotMet},
+		{"Ignored", testCounter{count: -1}, []Option{IgnoreUnexported()}, nil},
+		{"Slice", testCounter{count: 3, limits: []int{2}}, nil, ErrNotMet},
+		{"Pointer", &testCounter{count: 3, parent: &testCounter{count: 2}}, nil, ErrNotMet},
+		{"Nested", testCounter{lines: map[int]testLine{1: {Price: 0}}}, nil, ErrNotMet},
+		{"NestedIgnored", testCounter{lines: map[int]testLine{1: {Price: 0}}}, []Option{IgnoreUnexported()}, nil},
+		{"Method", testCounter{email: "a@example.com"}, nil, nil},
+		{"CompositeMethod", struct {
+			id testID `refine:"!id.IsZero()"`
+		}{id: testID{1}}, nil, ErrEval},
+		{"Big", struct {
+			n *big.Int `refine:"n > 0"`
+		}{n: big.NewInt(1)}, nil, nil},
+		{"BigNotMet", struct {
+			n *big.Int `refine:"n > 0"`
+		}{n: big.NewInt(-1)}, nil, ErrNotMet},
+		{"BigValue", &struct {
+			r big.Rat `refine:"r < bigRat(1) && r > 0"`
+		}{r: *big.NewRat(1, 2)}, nil, nil},
+		{"BigInMap", struct {
+			M map[int]struct {
+				f big.Float `refine:"f > 0"`
+			}
+		}{M: map[int]struct {
+			f big.Float `refine:"f > 0"`
+		}{1: {}}}, nil, ErrNotMet},
+		{"BigUnreferenced", struct {
+			N int      `refine:"N == 0"`
+			n *big.Int `refine:"true"`
+		}{n: big.NewInt(1)}, nil, nil},
+		{"IgnoredReference", struct {
+			A int `refine:"A == a"`
+			a int
+		}{}, []Option{IgnoreUnexported()}, ErrEval},
+		{"PointerEqual", samePointer{P: &n, q: &n}, nil, nil},
+		{"PointerNotEqual", samePointer{P: &n, q: &m}, nil, ErrNotMet},
+		{"PointerNil", samePointer{}, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value, tc.opts...)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type testAccount struct {
+	ID    int      `refine:"ID >= 0; create: ID == 0; update: ID > 0"`
+	Owner string   "refine:\"admin: Owner != ``\""
+	_     struct{} `refine:"update: ID != 7"`
+}
+
+func TestCheckGroups(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value testAccount
+		opts  []Option
+
+		want     error
+		wantText string
+	}{
+		{"Default", testAccount{ID: 1}, nil, nil, ""},
+		{"DefaultNotMet", testAccount{ID: -1}, []Option{Groups("update")}, ErrNotMet, `"ID >= 0"`},
+		{"Create", testAccount{ID: 0}, []Option{Groups("create")}, nil, ""},
+		{"CreateNotMet", testAccount{ID: 1}, []Option{Groups("create")}, ErrNotMet, `"create: ID == 0"`},
+		{"Update", testAccount{ID: 1}, []Option{Groups("update")}, nil, ""},
+		{"UpdateNotMet", testAccount{ID: 0}, []Option{Groups("update")}, ErrNotMet, `"update: ID > 0"`},
+		{"StructNotMet", testAccount{ID: 7}, []Option{Groups("update")}, ErrNotMet, `refine.Check: testAccount "update: ID != 7"`},
+		{"Several", testAccount{ID: 1}, []Option{Groups("update", "admin")}, ErrNotMet, "testAccount.Owner"},
+		{"Accumulated", testAccount{ID: 1}, []Option{Groups("update"), Groups("admin")}, ErrNotMet, "testAccount.Owner"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value, tc.opts...)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+
+	// Groups given to Check don't change those of the Checker.
+	c := NewChecker(Groups("create"))
+	if err := c.Check(testAccount{ID: 1}, Groups("admin")); !errors.Is(err, ErrNotMet) {
+		t.Fatalf("got %v; want %v", err, ErrNotMet)
+	}
+	if err := c.Check(testAccount{ID: 0}); err != nil {
+		t.Fatalf("got %v; want <nil>", err)
+	}
+}
+
+type testSignup struct {
+	Name  string `refine:"len(Name) > 0; len(Name) < 5"`
+	Email string `refine:"isEmail(Email)"`
+	Tags  []int  `refine:",required"`
+	Items []testItem
+}
+
+type testItem struct {
+	Quantity int `refine:"Quantity > 0"`
+	Price    int `refine:"Price >= 0"`
+}
+
+func TestCheckAll(t *testing.T) {
+	invalid := testSignup{
+		Name:  "",
+		Email: "user",
+		Items: []testItem{{Quantity: 0, Price: 1}, {Quantity: 1, Price: -1}},
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+		opts  []Option
+
+		want      error
+		wantTexts []string
+	}{
+		{"Met", testSignup{Name: "a", Email: "a@example.com", Tags: []int{}}, nil, nil, nil},
+		{"All", invalid, nil, ErrNotMet, []string{
+			`testSignup.Name = "", "len(Name) > 0" not met`,
+			`testSignup.Email = "user", "isEmail(Email)" not met`,
+			`testSignup.Tags = []int(nil), ",required" not met: value is required`,
+			`testSignup.Items[0].Quantity = 0, "Quantity > 0" not met`,
+			`testSignup.Items[1].Price = -1, "Price >= 0" not met`,
+		}},
+		{"Clauses", testSignup{Name: "abcdef", Email: "a@example.com", Tags: []int{}}, nil, ErrNotMet, []string{
+			`testSignup.Name = "abcdef", "len(Name) < 5" not met`,
+		}},
+		{"MaxErrors", invalid, []Option{MaxErrors(2)}, ErrNotMet, []string{
+			`testSignup.Name = "", "len(Name) > 0" not met`,
+			`testSignup.Email = "user", "isEmail(Email)" not met`,
+		}},
+		{"FailFast", invalid, []Option{FailFast()}, ErrNotMet, []string{
+			`testSignup.Name = "", "len(Name) > 0" not met`,
+		}},
+		{"Parse", struct {
+			A int `refine:"A >"`
+			B int `refine:"B > 0"`
+		}{}, nil, ErrParse, []string{
+			`"A >" could not be parsed`,
+			`"B > 0" not met`,
+		}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckAll(tc.value, tc.opts...)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got == nil {
+				return
+			}
+
+			var errs Errors
+			if !errors.As(got, &errs) {
+				t.Fatalf("got %T; want Errors", got)
+			}
+			if len(errs) != len(tc.wantTexts) {
+				t.Fatalf("got %d errors:\n%v\nwant %d", len(errs), got, len(tc.wantTexts))
+			}
+			for i, text := range tc.wantTexts {
+				if !strings.Contains(errs[i].Error(), text) {
+					t.Fatalf("got error %d %v; want it to contain %q", i, errs[i], text)
+				}
+			}
+
+			// Check returns the first of the errors.
+			if err := Check(tc.value, tc.opts...); err == nil || err.Error() != errs[0].Error() {
+				t.Fatalf("got Check error %v; want %v", err, errs[0])
+			}
+		})
+	}
+
+	if err := CheckAll(1); !errors.Is(err, ErrNotStruct) {
+		t.Fatalf("got %v; want %v", err, ErrNotStruct)
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	value := testSignup{
+		Name:  "abc",
+		Email: "user@example.com",
+		Tags:  []int{1},
+		Items: []testItem{{Quantity: 1, Price: 2}, {Quantity: 3, Price: 4}},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Check(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package refine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// References that refinements can use to read the fields of structs other than
+// the one they are on.
+const (
+	refRoot   = "$root"   // The struct given to Check.
+	refParent = "$parent" // The struct containing the one being checked.
+)
+
+// frame is a struct being checked, and the struct it was reached from.
+type frame struct {
+	value  reflect.Value
+	path   string // Path to the struct from the root, e.g. Order.Items[0].
+	parent *frame
+}
+
+func (f *frame) root() *frame {
+	for f.parent != nil {
+		f = f.parent
+	}
+	return f
+}
+
+// bind adds the references that can be used from the struct of f to a symbol
+// table. $parent is not bound for the root, which has no parent.
+func (f *frame) bind(symbols map[string]box) error {
+	root, err := boxValue(f.root().value)
+	if err != nil {
+		return err
+	}
+	symbols[refRoot] = root
+
+	delete(symbols, refParent)
+	if f.parent != nil {
+		parent, err := boxValue(f.parent.value)
+		if err != nil {
+			return err
+		}
+		symbols[refParent] = parent
+	}
+	return nil
+}
+
+// resolved describes what the references used by a refinement resolved to,
+// e.g. "where $root is Order", or returns "" if it doesn't use any.
+func (f *frame) resolved(refinement string) string {
+	var refs []string
+	if strings.Contains(refinement, refRoot) {
+		refs = append(refs, fmt.Sprintf("%s is %s", refRoot, f.root().path))
+	}
+	if strings.Contains(refinement, refParent) && f.parent != nil {
+		refs = append(refs, fmt.Sprintf("%s is %s", refParent, f.parent.path))
+	}
+	if len(refs) == 0 {
+		return ""
+	}
+	return "where " + strings.Join(refs, " and ")
+}
+
+// selectField selects the field called name from a struct, or from the struct
+// a pointer points to. Unexported fields can be selected unless ignored.
+func selectField(b box, name string, ignoreUnexported bool) (box, error) {
+	if b.dynamic {
+		return box{}, errNotNarrowed
+	}
+	if b.kind != boxStruct && b.kind != boxPointer {
+		return box{}, fmt.Errorf("kind %d has no field %s", b.kind, name)
+	}
+	if b.val == nil {
+		return box{}, fmt.Errorf("cannot select %s of nil pointer", name)
+	}
+
+	v := b.value()
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return box{}, fmt.Errorf("%s has no field %s", v.Type(), name)
+	}
+
+	field, ok := v.Type().FieldByName(name)
+	if !ok {
+		return box{}, fmt.Errorf("%s has no field %s", v.Type(), name)
+	}
+	if !field.IsExported() && ignoreUnexported {
+		return box{}, fmt.Errorf("field %s of %s is unexported", name, v.Type())
+	}
+	value, err := v.FieldByIndexErr(field.Index)
+	if err != nil {
+		return box{}, fmt.Errorf("cannot select %s: %w", name, err)
+	}
+	return boxValue(value)
+}
+
+// walk is the state of a call to Check as it descends into nested structs.
+type walk struct {
+	cfg  config
+	all  bool             // Whether to carry on after the first error.
+	errs Errors           // Errors found so far.
+	seen map[seenKey]bool // Pointers, slices and maps already descended into.
+}
+
+// fail records an error found by the walk, and reports whether the walk
+// should stop there.
+func (w *walk) fail(err error) bool {
+	w.errs = append(w.errs, err)
+	return !w.all || w.cfg.failFast || w.cfg.maxErrors > 0 && len(w.errs) >= w.cfg.maxErrors
+}
+
+// seenKey identifies a pointer, slice or map. Slices sharing an array are
+// only the same if they have the same length too.
+type seenKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// visit records that the pointer, slice or map v is being descended into, and
+// reports whether it already was.
+func (w *walk) visit(v reflect.Value) bool {
+	key := seenKey{v.Pointer(), v.Type(), 0}
+	if v.Kind() != reflect.Pointer {
+		key.len = v.Len()
+	}
+	if w.seen[key] {
+		return true
+	}
+	w.seen[key] = true
+	return false
+}
+
+// visible reports whether a field can be read by refinements.
+func (w *walk) visible(field reflect.StructField) bool {
+	return field.IsExported() || !w.cfg.ignoreUnexported
+}
+
+// joinPath appends the name of a field to the path of a struct.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// descend checks the structs held by v, which is reached from the struct of
+// parent by path. Structs are found through pointers, and in slices, arrays
+// and map values, but not in interfaces. Each pointer, slice and map is only
+// followed once, so that cycles through them end.
+// It reports whether the walk should stop.
+func (c *Checker) descend(w *walk, parent *frame, path string, v reflect.Value) bool {
+	if !hasRefinements(v.Type()) {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || w.visit(v) {
+			return false
+		}
+		return c.descend(w, parent, path, v.Elem())
+	case reflect.Struct:
+		return c.checkStruct(w, &frame{value: v, path: path, parent: parent})
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.Len() == 0 || w.visit(v)) {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if c.descend(w, parent, fmt.Sprintf("%s[%d]", path, i), v.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		if v.Len() == 0 || w.visit(v) {
+			return false
+		}
+		// Map values are checked in the order of their keys, so that the same
+		// error is reported each time.
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = fmt.Sprintf("%#v", key)
+		}
+		sort.Sort(byName{keys, names})
+		for i, key := range keys {
+			// Map values aren't addressable, so they are copied to make
+			// their fields addressable, unless they are read from an
+			// unexported field.
+			elem := v.MapIndex(key)
+			if elem.CanInterface() {
+				p := reflect.New(elem.Type()).Elem()
+				p.Set(elem)
+				elem = p
+			}
+			if c.descend(w, parent, fmt.Sprintf("%s[%s]", path, names[i]), elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// byName sorts map keys by their formatted names.
+type byName struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (b byName) Len() int           { return len(b.keys) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+}
+
+// refinable caches whether types have refinements. See hasRefinements.
+var refinable sync.Map // map[reflect.Type]bool
+
+// hasRefinements reports whether values of type t are structs with
+// refinements, or hold such structs in the ways that descend follows.
+func hasRefinements(t reflect.Type) bool {
+	if r, ok := refinable.Load(t); ok {
+		return r.(bool)
+	}
+	// Results for types in a cycle depend on the type the cycle started at,
+	// so only the result for t itself is cached.
+	r := findRefinements(t, map[reflect.Type]bool{})
+	refinable.Store(t, r)
+	return r
+}
+
+func findRefinements(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return findRefinements(t.Elem(), visiting)
+	case reflect.Struct:
+	default:
+		return false
+	}
+
+	if _, ok := bigKinds[t]; ok {
+		return false
+	}
+	if t.Implements(structRefinerType) || reflect.PointerTo(t).Implements(structRefinerType) {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+		if findRefinements(field.Type, visiting) {
+			return true
+		}
+	}
+	return false
+}
+
+var structRefinerType = reflect.TypeOf((*StructRefiner)(nil)).Elem()
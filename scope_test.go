@@ -0,0 +1,236 @@
+package refine
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckReferences(t *testing.T) {
+	type item struct {
+		Qty int
+	}
+
+	type order struct {
+		MaxQty int   `refine:"MaxQty > 0"`
+		Item   item  `refine:"Item.Qty <= $root.MaxQty"`
+		Spare  *item `refine:"Spare == nil || Spare.Qty < $root.Item.Qty"`
+	}
+
+	testCases := []struct {
+		name  string
+		value any
+
+		want     error
+		wantText string
+	}{
+		{"Met", order{MaxQty: 5, Item: item{Qty: 5}}, nil, ""},
+		{"Pointer", &order{MaxQty: 5, Item: item{Qty: 5}, Spare: &item{Qty: 1}}, nil, ""},
+		{"NotMet", order{MaxQty: 5, Item: item{Qty: 6}}, ErrNotMet, "(where $root is order)"},
+		{"PointerNotMet", order{MaxQty: 5, Item: item{Qty: 5}, Spare: &item{Qty: 5}}, ErrNotMet, "(where $root is order)"},
+		{"NoParent", struct {
+			A int `refine:"A == $parent.A"`
+		}{}, ErrEval, "$parent"},
+		{"NoField", struct {
+			A int `refine:"A == $root.B"`
+		}{}, ErrEval, "has no field B"},
+		{"NilPointer", struct {
+			P *item `refine:"P.Qty == 0"`
+		}{}, ErrEval, "nil pointer"},
+		{"NotStruct", struct {
+			A int `refine:"A.B == 0"`
+		}{}, ErrEval, "has no field B"},
+		{"Unexported", struct {
+			A struct{ b int } `refine:"A.b == 0"`
+		}{}, nil, ""},
+		{"Interface", struct {
+			A any `refine:"A.B == 0"`
+		}{A: item{}}, ErrEval, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+type testLine struct {
+	Price int `refine:"Price > 0"`
+	Qty   int `refine:"Qty <= $root.MaxQty && Qty <= $parent.MaxQty"`
+}
+
+type testOrder struct {
+	MaxQty int        `refine:"MaxQty > 0"`
+	Lines  []testLine `refine:"len(Lines) > 0"`
+}
+
+type testCustomer struct {
+	MaxQty int                  `refine:"MaxQty > 0"`
+	Orders []*testOrder         `refine:"true"`
+	Named  map[string]testOrder `refine:"true"`
+	Fixed  [1]testLine          `refine:"true"`
+	Next   *testCustomer        `refine:"true"`
+	Other  struct{ N, M *int }  `refine:"true"`
+}
+
+func TestCheckNested(t *testing.T) {
+	line := testLine{Price: 1, Qty: 1}
+	order := &testOrder{MaxQty: 5, Lines: []testLine{line}}
+	valid := func() testCustomer {
+		return testCustomer{
+			MaxQty: 10,
+			Orders: []*testOrder{order, nil},
+			Named:  map[string]testOrder{"a": *order},
+			Fixed:  [1]testLine{line},
+		}
+	}
+
+	cycle := &testCustomer{MaxQty: 1, Fixed: [1]testLine{line}}
+	cycle.Next = cycle
+
+	testCases := []struct {
+		name   string
+		modify func(c *testCustomer)
+
+		want     error
+		wantText string
+	}{
+		{"Met", func(c *testCustomer) {}, nil, ""},
+		{"Slice", func(c *testCustomer) {
+			c.Orders = []*testOrder{order, {MaxQty: 5, Lines: []testLine{line, {Price: 0, Qty: 1}}}}
+		}, ErrNotMet, "testCustomer.Orders[1].Lines[1].Price = 0"},
+		{"SliceOwnRefinement", func(c *testCustomer) {
+			c.Orders = []*testOrder{{MaxQty: 5}}
+		}, ErrNotMet, "testCustomer.Orders[0].Lines = []refine.testLine(nil)"},
+		{"Map", func(c *testCustomer) {
+			c.Named = map[string]testOrder{"b": *order, "a": {MaxQty: 0, Lines: []testLine{line}}}
+		}, ErrNotMet, `testCustomer.Named["a"].MaxQty`},
+		{"Array", func(c *testCustomer) {
+			c.Fixed[0].Price = -1
+		}, ErrNotMet, "testCustomer.Fixed[0].Price"},
+		{"Root", func(c *testCustomer) {
+			c.MaxQty = 1
+			c.Orders = []*testOrder{{MaxQty: 5, Lines: []testLine{{Price: 1, Qty: 2}}}}
+		}, ErrNotMet, "testCustomer.Orders[0].Lines[0].Qty = 2, \"Qty <= $root.MaxQty && Qty <= $parent.MaxQty\" not met"},
+		{"Parent", func(c *testCustomer) {
+			c.Orders = []*testOrder{{MaxQty: 1, Lines: []testLine{line, {Price: 1, Qty: 2}}}}
+		}, ErrNotMet, "(where $root is testCustomer and $parent is testCustomer.Orders[0])"},
+		{"Pointer", func(c *testCustomer) {
+			c.Next = &testCustomer{MaxQty: 0}
+		}, ErrNotMet, "testCustomer.Next.MaxQty"},
+		{"Cycle", func(c *testCustomer) {
+			*c = *cycle
+		}, nil, ""},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid()
+			tc.modify(&c)
+			got := Check(&c)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+type testTree struct {
+	X    int `refine:"X > 0"`
+	Kids []testTree
+	Map  map[string]testTree
+}
+
+func TestCheckValueCycle(t *testing.T) {
+	slice := testTree{X: 1}
+	slice.Kids = make([]testTree, 1)
+	slice.Kids[0] = slice
+
+	m := testTree{X: 1, Map: map[string]testTree{}}
+	m.Map["a"] = m
+
+	bad := testTree{X: 1}
+	bad.Kids = make([]testTree, 2)
+	bad.Kids[0] = bad
+	bad.Kids[1] = testTree{X: 0}
+
+	testCases := []struct {
+		name  string
+		value testTree
+
+		want     error
+		wantText string
+	}{
+		{"Slice", slice, nil, ""},
+		{"Map", m, nil, ""},
+		{"NotMet", bad, ErrNotMet, "testTree.Kids[1].X = 0"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.value)
+			if !errors.Is(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if got != nil && !strings.Contains(got.Error(), tc.wantText) {
+				t.Fatalf("got %v; want it to contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+type (
+	testCycleA struct {
+		B *testCycleB
+		X int `refine:"X > 0"`
+	}
+	testCycleB struct {
+		A []testCycleA
+	}
+	testCycleC struct {
+		C map[string]*testCycleC
+	}
+)
+
+func TestHasRefinements(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value any
+
+		want bool
+	}{
+		{"Tagged", testLine{}, true},
+		{"Slice", []*testLine{}, true},
+		{"Map", map[int][2]testLine{}, true},
+		{"StructRefiner", testRange{}, true},
+		{"Untagged", struct{ A int }{}, false},
+		{"Interface", struct{ A any }{}, false},
+		{"Big", struct{ A *big.Int }{}, false},
+		{"CycleThroughTagged", testCycleB{}, true},
+		{"CycleUntagged", testCycleC{}, false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hasRefinements(reflect.TypeOf(tc.value)); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
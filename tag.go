@@ -0,0 +1,140 @@
+package refine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ErrRequired is returned when a field with the required tag option is nil.
+// It wraps ErrNotMet.
+var ErrRequired = fmt.Errorf("%w: value is required", ErrNotMet)
+
+// fieldTag is the refine tag of a field: a refinement, followed by options
+// separated by commas, e.g. `refine:"len(Tags) > 0,required"`. Only known
+// options are split off, so refinements may still contain commas.
+type fieldTag struct {
+	refinement string
+	tagged     bool // Whether the field has a refine tag at all.
+	skip       bool // "-": the field is not checked, or descended into.
+	omitEmpty  bool // "omitempty": the field is not checked if it is zero.
+	required   bool // "required": the field must not be nil.
+}
+
+var tagOptions = map[string]func(t *fieldTag){
+	"omitempty": func(t *fieldTag) { t.omitEmpty = true },
+	"required":  func(t *fieldTag) { t.required = true },
+}
+
+func parseTag(field reflect.StructField) fieldTag {
+	s, ok := field.Tag.Lookup(tag)
+	t := fieldTag{tagged: ok}
+	if strings.TrimSpace(s) == "-" {
+		t.skip = true
+		return t
+	}
+
+	for {
+		i := strings.LastIndex(s, ",")
+		if i < 0 {
+			break
+		}
+		set, ok := tagOptions[strings.TrimSpace(s[i+1:])]
+		if !ok {
+			break
+		}
+		set(&t)
+		s = s[:i]
+	}
+	if set, ok := tagOptions[strings.TrimSpace(s)]; ok {
+		// The tag only has options.
+		set(&t)
+		s = ""
+	}
+
+	t.refinement = strings.TrimSpace(s)
+	return t
+}
+
+// validate returns an error if the options of a tag can't be used on a field
+// of type typ.
+func (t fieldTag) validate(typ reflect.Type) error {
+	if !t.required {
+		return nil
+	}
+	if t.omitEmpty {
+		return fmt.Errorf("%w: omitempty and required can't be used together", ErrParse)
+	}
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		return nil
+	}
+	return fmt.Errorf("%w: required can't be used on a %s", ErrParse, typ.Kind())
+}
+
+// clause is one of the semicolon separated parts of a refinement, with the
+// group it belongs to.
+type clause struct {
+	group  string // Empty for the default group.
+	expr   string
+	index  int // Position of the clause among those of the refinement.
+	offset int // Byte offset of expr in the refinement.
+}
+
+func (c clause) String() string {
+	if c.group == "" {
+		return c.expr
+	}
+	return c.group + ": " + c.expr
+}
+
+// splitClauses splits a refinement into clauses at the semicolons outside of
+// string literals. Empty clauses are dropped.
+func splitClauses(refinement string) []clause {
+	var clauses []clause
+	var quoted bool
+	start := 0
+	for i := 0; i < len(refinement); i++ {
+		switch c := refinement[i]; {
+		case c == '`':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			clauses = appendClause(clauses, refinement[start:i], start)
+			start = i + 1
+		}
+	}
+	return appendClause(clauses, refinement[start:], start)
+}
+
+// appendClause appends the clause s, found at offset in its refinement.
+func appendClause(clauses []clause, s string, offset int) []clause {
+	if cl := parseClause(s); cl.expr != "" {
+		cl.index = len(clauses)
+		cl.offset += offset
+		return append(clauses, cl)
+	}
+	return clauses
+}
+
+// parseClause splits the group prefix, such as "create:", off a clause.
+func parseClause(s string) clause {
+	cl := clause{expr: strings.TrimSpace(s), offset: leadingSpace(s)}
+	i := strings.IndexByte(cl.expr, ':')
+	if i < 0 {
+		return cl
+	}
+	group := strings.TrimSpace(cl.expr[:i])
+	if !isIdentifier(group) {
+		return cl
+	}
+	rest := cl.expr[i+1:]
+	cl.offset += i + 1 + leadingSpace(rest)
+	cl.group, cl.expr = group, strings.TrimSpace(rest)
+	return cl
+}
+
+// leadingSpace returns the length of the white space at the start of s.
+func leadingSpace(s string) int {
+	return len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
@@ -0,0 +1,70 @@
+package refine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	testCases := []struct {
+		tag reflect.StructTag
+
+		want fieldTag
+	}{
+		{``, fieldTag{}},
+		{`json:"a"`, fieldTag{}},
+		{`refine:""`, fieldTag{tagged: true}},
+		{`refine:"-"`, fieldTag{tagged: true, skip: true}},
+		{`refine:"A > 0"`, fieldTag{refinement: "A > 0", tagged: true}},
+		{`refine:"A > 0,omitempty"`, fieldTag{refinement: "A > 0", tagged: true, omitEmpty: true}},
+		{`refine:"len(A) > 0, required"`, fieldTag{refinement: "len(A) > 0", tagged: true, required: true}},
+		{`refine:"required"`, fieldTag{tagged: true, required: true}},
+		{`refine:",omitempty"`, fieldTag{tagged: true, omitEmpty: true}},
+		{"refine:\"oneOf(A, `a`, `b`)\"", fieldTag{refinement: "oneOf(A, `a`, `b`)", tagged: true}},
+		{`refine:"f(A, required)"`, fieldTag{refinement: "f(A, required)", tagged: true}},
+		{`refine:"A, other"`, fieldTag{refinement: "A, other", tagged: true}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(string(tc.tag), func(t *testing.T) {
+			got := parseTag(reflect.StructField{Name: "A", Tag: tc.tag})
+			if got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitClauses(t *testing.T) {
+	testCases := []struct {
+		refinement string
+
+		want []clause
+	}{
+		{"", nil},
+		{"A > 0", []clause{{"", "A > 0", 0, 0}}},
+		{" A > 0; ", []clause{{"", "A > 0", 0, 1}}},
+		{"create: ID == 0; update: ID > 0", []clause{{"create", "ID == 0", 0, 8}, {"update", "ID > 0", 1, 25}}},
+		{"ID >= 0;admin:ID < 10", []clause{{"", "ID >= 0", 0, 0}, {"admin", "ID < 10", 1, 14}}},
+		{"update:", nil},
+		{"S != `a;b: c`; x: S != ``", []clause{{"", "S != `a;b: c`", 0, 0}, {"x", "S != ``", 1, 18}}},
+		{"S == `a:b`", []clause{{"", "S == `a:b`", 0, 0}}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.refinement, func(t *testing.T) {
+			got := splitClauses(tc.refinement)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			for _, cl := range got {
+				if s := tc.refinement[cl.offset:]; !strings.HasPrefix(s, cl.expr) {
+					t.Fatalf("got offset %d of %q at %q", cl.offset, cl.expr, s)
+				}
+			}
+		})
+	}
+}